@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/keystore"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configCluster  string
+	configSelector string
+	configUnset    bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change settings in ~/.config/multi-oc/config.yaml",
+	Long: `Settings apply to all clusters (defaults), to clusters whose labels match a selector
+(match rules, applied in file order) or to single clusters (by name or hub/name); the more
+specific setting wins, and environment variables win over the file.
+
+Keys: caFile, insecure, proxy, namespace, requestTimeout, apiURL, credentialBackend`,
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print config.yaml",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configstate.ConfigPath()
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && len(b) == 0) {
+			fmt.Printf("# %s: no settings\n", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+		if _, err := configstate.LoadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print a setting (with --cluster: the value in effect for that cluster)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configCluster != "" && configSelector != "" {
+			return fmt.Errorf("pass --cluster or --selector, not both")
+		}
+		cfg, err := configstate.LoadConfig()
+		if err != nil {
+			return err
+		}
+		var s configstate.Settings
+		switch {
+		case configCluster != "":
+			// Labels for match rules come from the discovery cache
+			if s, err = configstate.ClusterSettings(configCluster, cachedLabels(configCluster)); err != nil {
+				return err
+			}
+		case configSelector != "":
+			for _, r := range cfg.Match {
+				if r.Selector == configSelector {
+					s = s.Merge(r.Settings)
+				}
+			}
+		default:
+			s = cfg.Defaults
+		}
+		v, err := s.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			fmt.Fprintln(os.Stderr, "(not set)")
+			return nil
+		}
+		fmt.Println(v)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY [VALUE]",
+	Short: "Set a setting, globally, for a cluster (--cluster) or for matching clusters (--selector)",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configCluster != "" && configSelector != "" {
+			return fmt.Errorf("pass --cluster or --selector, not both")
+		}
+		key, value := args[0], ""
+		switch {
+		case configUnset && len(args) == 2:
+			return fmt.Errorf("pass a value or --unset, not both")
+		case !configUnset && len(args) == 1:
+			return fmt.Errorf("missing value for %s (or use --unset)", key)
+		case len(args) == 2:
+			value = args[1]
+		}
+		if configCluster != "" {
+			if err := validateQualifiedName(configCluster); err != nil {
+				return err
+			}
+		}
+		value, err := normalizeSetting(key, value)
+		if err != nil {
+			return err
+		}
+		if err := configstate.SetConfigValue(configCluster, configSelector, key, value); err != nil {
+			return err
+		}
+		if key == "credentialBackend" {
+			fmt.Fprintln(os.Stderr, "Note: tokens already stored are not moved; 'moc tokens backend' moves them.")
+		}
+		return nil
+	},
+}
+
+// normalizeSetting makes file paths absolute; configstate.SetConfigValue checks the value. A
+// helper backend is also checked for its command here, which a hand-edited file may leave to
+// MOC_CREDENTIAL_HELPER.
+func normalizeSetting(key, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch key {
+	case "caFile":
+		return filepath.Abs(value)
+	case "credentialBackend":
+		if _, err := keystore.ParseBackend(value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// validateQualifiedName accepts "cluster" and "hub/cluster".
+func validateQualifiedName(name string) error {
+	hub, cluster := splitHubQualified(name)
+	if hub != "" {
+		if err := configstate.ValidateHubName(hub); err != nil {
+			return err
+		}
+	}
+	return keystore.ValidateClusterName(cluster)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{configGetCmd, configSetCmd} {
+		c.Flags().StringVar(&configCluster, "cluster", "", "Setting of this cluster (name or hub/name)")
+		c.Flags().StringVarP(&configSelector, "selector", "l", "", "Setting of the rule for clusters matching this label selector")
+	}
+	configSetCmd.Flags().BoolVar(&configUnset, "unset", false, "Remove the setting")
+	configCmd.AddCommand(configViewCmd, configGetCmd, configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
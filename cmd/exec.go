@@ -1,18 +1,27 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"multi-oc/internal/configstate"
 	"multi-oc/internal/discovery"
+	"multi-oc/internal/fanout"
 	"multi-oc/internal/identity"
 	"multi-oc/internal/keystore"
 	"multi-oc/internal/kubeexec"
+	"multi-oc/internal/output"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var execCmd = &cobra.Command{
@@ -20,52 +29,297 @@ var execCmd = &cobra.Command{
 	Short: "Execute an oc command against a target cluster",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		clusterName := args[0]
-		ocArgs := args[1:]
-		if len(ocArgs) == 0 {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-			defer cancel()
-			_ = identity.EnsureHubLogin(ctx)
-			return fmt.Errorf("Please pass oc arguments, e.g.,: get nodes")
+		return RunDirect(args)
+	},
+}
+
+// RunDirect handles "moc [flags] <cluster> [oc args...]" and "moc --clusters a,b [oc args...]".
+// It bypasses cobra flag parsing so that oc flags are passed through untouched.
+func RunDirect(args []string) error {
+	keystore.SetClusterLabels(cachedLabels)
+	opts, rest, err := parseDirectArgs(args)
+	if err != nil {
+		return err
+	}
+	if _, err := configstate.LoadConfig(); err != nil {
+		return err
+	}
+	names := opts.clusters
+	if !opts.fanout() {
+		if len(rest) == 0 {
+			return fmt.Errorf("Please pass a cluster name, e.g.,: moc cluster1 get nodes")
 		}
+		names, rest = rest[:1], rest[1:]
+	}
+	if names, opts.hub, err = qualifiedHub(names, opts.hub); err != nil {
+		return err
+	}
+	if opts.hub != "" {
+		if err := selectHub(opts.hub); err != nil {
+			return err
+		}
+	}
+	if opts.fanout() {
+		opts.clusters = names
+		return runFanout(opts, rest)
+	}
+	return runSingle(opts, names[0], rest)
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+func runSingle(opts targetOptions, clusterName string, ocArgs []string) error {
+	if len(ocArgs) == 0 {
+		ctx, cancel := context.WithTimeout(opts.context(context.Background()), 2*time.Minute)
 		defer cancel()
+		_ = identity.EnsureHubLogin(ctx)
+		return fmt.Errorf("Please pass oc arguments, e.g.,: get nodes")
+	}
+
+	ctx, cancel := runContext(10 * time.Minute)
+	defer cancel()
+	ctx = opts.context(ctx)
 
-		cluster, err := discovery.GetCluster(ctx, clusterName)
+	cluster, err := findClusterHub(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+	if cluster, err = kubeexec.SelectEndpoint(ctx, cluster, opts.exec); err != nil {
+		return err
+	}
+	if cluster.APIURL == "" {
+		return fmt.Errorf("API URL for cluster %s not found", clusterName)
+	}
+	warnUnavailable(cluster)
+
+	// Attempt oc call; only if the API server rejected the token (401) delete it and, if the command
+	// can safely run again (kubeexec.RetrySafe), retry once with a fresh token.
+	// Any other failure is oc's own result and is passed through with its exit code.
+	for attempt := 0; ; attempt++ {
+		authArgs, cleanup, err := kubeexec.BuildOcAuthArgs(ctx, cluster, opts.exec)
 		if err != nil {
 			return err
 		}
-		if cluster.APIURL == "" {
-			return fmt.Errorf("API URL for cluster %s not found", clusterName)
-		}
 
-		// Attempt oc call, on first auth failure delete stored token and retry once
-		for attempt := 0; attempt < 2; attempt++ {
-			authArgs, cleanup, err := kubeexec.BuildOcAuthArgs(ctx, cluster)
-			if err != nil {
-				return err
+		var stderr bytes.Buffer
+		argsAll := append([]string{"--request-timeout=" + kubeexec.RequestTimeout(cluster)}, authArgs...)
+		argsAll = append(argsAll, ocArgs...)
+		command := exec.CommandContext(ctx, "oc", argsAll...)
+		command.Stdout = os.Stdout
+		command.Stderr = io.MultiWriter(os.Stderr, &stderr)
+		command.Stdin = os.Stdin
+		err = command.Run()
+		cleanup()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return &ExitError{Code: 130}
+		}
+		if attempt == 0 && kubeexec.IsAuthFailure(stderr.Bytes()) && kubeexec.CanRefreshToken(cluster) {
+			_ = keystore.DeleteTargetToken(kubeexec.TokenKey(cluster.Name, opts.exec.Auth))
+			if !kubeexec.RetrySafe(ocArgs, !term.IsTerminal(int(os.Stdin.Fd()))) {
+				fmt.Fprintln(os.Stderr, notRetried)
+				return exitError(err)
 			}
-			defer cleanup()
-
-			argsAll := append([]string{"--request-timeout=30s"}, authArgs...)
-			argsAll = append(argsAll, ocArgs...)
-			command := exec.CommandContext(ctx, "oc", argsAll...)
-			command.Stdout = os.Stdout
-			command.Stderr = os.Stderr
-			command.Stdin = os.Stdin
-			if err := command.Run(); err != nil {
-				if attempt == 0 {
-					_ = keystore.DeleteTargetToken(cluster.Name)
-					_, _ = os.Stderr.WriteString("Authentication failed. Please provide a fresh token when prompted.\n")
-					continue
-				}
-				return err
+			_, _ = os.Stderr.WriteString("Authentication failed. Please provide a fresh token when prompted.\n")
+			continue
+		}
+		return exitError(err)
+	}
+}
+
+// runContext returns a context with the given timeout that is also cancelled on SIGINT/SIGTERM/SIGHUP.
+// Instead of terminating moc right away, the signal stops the running oc calls so that deferred
+// cleanups (temporary kubeconfigs holding tokens) still run.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// ExitError carries the exit code of a failed oc call so that moc can exit with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("oc exited with code %d", e.Code)
+}
+
+func exitError(err error) error {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() > 0 {
+		return &ExitError{Code: ee.ExitCode()}
+	}
+	return err
+}
+
+// runFanout executes the same oc command on every selected cluster with bounded concurrency.
+// Credentials are collected sequentially first (prompting where needed), then oc runs in parallel.
+func runFanout(opts targetOptions, ocArgs []string) error {
+	if len(ocArgs) == 0 {
+		return fmt.Errorf("Please pass oc arguments, e.g.,: get nodes")
+	}
+
+	// -o json|yaml|ndjson: ask oc for JSON and merge the documents of all clusters.
+	// Plain "get" (also -o wide / custom-columns): combine the tables oc prints into one.
+	// --collapse compares the raw oc output, so it disables both.
+	var (
+		format     output.Format
+		table      output.Table
+		structured bool
+		tabular    bool
+	)
+	if !opts.collapse {
+		format, ocArgs, structured = output.StructuredFormat(ocArgs)
+		if !structured {
+			table, ocArgs, tabular = output.TableFormat(ocArgs)
+		}
+	}
+
+	ctx, cancel := runContext(10 * time.Minute)
+	defer cancel()
+	ctx = opts.context(ctx)
+
+	clusters, err := resolveTargets(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(clusters) == 0 {
+		return fmt.Errorf("no clusters selected")
+	}
+
+	// Probe the API URLs of clusters with several of them in parallel before any prompt
+	endpointErrs := make([]error, len(clusters))
+	fanout.Each(len(clusters), opts.parallel, func(i int) {
+		clusters[i], endpointErrs[i] = kubeexec.SelectEndpoint(ctx, clusters[i], opts.exec)
+	})
+
+	targets := make([]fanout.Target, 0, len(clusters))
+	byName := make(map[string]discovery.Cluster, len(clusters))
+	for i, c := range clusters {
+		warnUnavailable(c)
+		byName[c.Name] = c
+		if endpointErrs[i] != nil {
+			targets = append(targets, fanout.Target{Cluster: c.Name, Err: endpointErrs[i]})
+			continue
+		}
+		t, cleanup := prepareTarget(ctx, c, ocArgs, opts.exec)
+		defer cleanup()
+		targets = append(targets, t)
+	}
+
+	report := func(r fanout.Result) {
+		if opts.collapse {
+			return
+		}
+		if !structured && !tabular {
+			fanout.WritePrefixed(os.Stdout, os.Stderr, r)
+			return
+		}
+		fanout.WritePrefixed(io.Discard, os.Stderr, r)
+		if format == output.NDJSON && r.OK() {
+			if err := output.WriteNDJSON(os.Stdout, r); err != nil {
+				fmt.Fprintln(os.Stderr, err)
 			}
-			return nil
 		}
-		return nil
-	},
+	}
+	// Results rejected with 401 are not printed yet if the command can safely run again: their
+	// tokens are refreshed and they run once more.
+	authFailed := func(r fanout.Result) bool {
+		return !r.OK() && kubeexec.IsAuthFailure(r.Stderr) && kubeexec.CanRefreshToken(byName[r.Cluster])
+	}
+	rerun := kubeexec.RetrySafe(ocArgs, false)
+	results := fanout.Run(ctx, targets, opts.parallel, func(r fanout.Result) {
+		if !rerun || !authFailed(r) {
+			report(r)
+		}
+	})
+	results = retryAuthFailures(ctx, results, byName, ocArgs, opts, authFailed, rerun, report)
+	if structured && format != output.NDJSON {
+		if err := output.WriteMerged(os.Stdout, os.Stderr, format, results); err != nil {
+			return err
+		}
+	}
+	if tabular {
+		if err := output.WriteTable(os.Stdout, os.Stderr, table, results); err != nil {
+			return err
+		}
+	}
+	if opts.collapse {
+		fanout.WriteCollapsed(os.Stdout, results)
+	}
+	fanout.WriteSummary(os.Stderr, results)
+	if n := fanout.Failed(results); n > 0 {
+		return fmt.Errorf("%d of %d cluster(s) failed", n, len(results))
+	}
+	return nil
+}
+
+// prepareTarget builds the oc invocation for one cluster of a fan-out run (may prompt for a token).
+func prepareTarget(ctx context.Context, c discovery.Cluster, ocArgs []string, execOpts kubeexec.Options) (fanout.Target, func()) {
+	t := fanout.Target{Cluster: c.Name}
+	if c.APIURL == "" {
+		t.Err = fmt.Errorf("API URL for cluster %s not found", c.Name)
+		return t, func() {}
+	}
+	authArgs, cleanup, err := kubeexec.BuildOcAuthArgs(ctx, c, execOpts)
+	if err != nil {
+		t.Err = err
+		return t, func() {}
+	}
+	t.Args = append([]string{"--request-timeout=" + kubeexec.RequestTimeout(c)}, authArgs...)
+	t.Args = append(t.Args, ocArgs...)
+	return t, cleanup
+}
+
+// notRetried explains why a command rejected with 401 is not run again (see kubeexec.RetrySafe).
+const notRetried = "The rejected token was removed. The command was not run again because it may have changed " +
+	"objects before the failure or read stdin; run it again to log in."
+
+// retryAuthFailures drops the rejected tokens of clusters that answered 401 (authFailed). If the
+// command can safely run again (rerun), it prompts for fresh tokens one cluster after another and
+// runs the command on those clusters once more.
+func retryAuthFailures(ctx context.Context, results []fanout.Result, byName map[string]discovery.Cluster,
+	ocArgs []string, opts targetOptions, authFailed func(fanout.Result) bool, rerun bool, onDone func(fanout.Result)) []fanout.Result {
+	var retry []fanout.Target
+	var idx []int
+	dropped := false
+	for i, r := range results {
+		if !authFailed(r) {
+			continue
+		}
+		c := byName[r.Cluster]
+		_ = keystore.DeleteTargetToken(kubeexec.TokenKey(c.Name, opts.exec.Auth))
+		if !rerun {
+			dropped = true
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Authentication failed for %s. Please provide a fresh token when prompted.\n", c.Name)
+		t, cleanup := prepareTarget(ctx, c, ocArgs, opts.exec)
+		defer cleanup()
+		retry = append(retry, t)
+		idx = append(idx, i)
+	}
+	if dropped {
+		fmt.Fprintln(os.Stderr, notRetried)
+	}
+	if len(retry) == 0 {
+		return results
+	}
+	for j, r := range fanout.Run(ctx, retry, opts.parallel, onDone) {
+		results[idx[j]] = r
+	}
+	return results
+}
+
+// warnUnavailable tells the user that oc will probably time out on a cluster the hub reports as unavailable.
+func warnUnavailable(c discovery.Cluster) {
+	if reason := c.Unavailability(); reason != "" {
+		fmt.Fprintf(os.Stderr, "Warning: cluster %s is not available (%s); use --available-only to skip such clusters\n", c.Name, reason)
+	}
 }
 
 func init() {
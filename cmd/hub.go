@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/identity"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	hubName        string
+	hubAddCAFile   string
+	hubAddInsecure bool
+)
+
+var hubCmd = &cobra.Command{
+	Use:   "hub",
+	Short: "Manage the hubs moc knows and choose the current one",
+	Long: `Each hub has a name, its own session and its own cluster tokens. Commands use the current
+hub; --hub NAME (or MOC_HUB) selects another one for a single call, and clusters can be
+addressed as hub/cluster.`,
+}
+
+var hubAddCmd = &cobra.Command{
+	Use:   "add NAME URL [URL...]",
+	Short: "Add a hub (log in with 'moc login --hub NAME')",
+	Long: `Add a hub. Several API URLs (e.g. a VIP and per-site load balancers) are endpoints of the
+same hub: they are tried in the given order and moc fails over when one is unreachable.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		urls := configstate.SplitURLs(strings.Join(args[1:], ","))
+		if len(urls) == 0 {
+			return fmt.Errorf("hub API URL is required")
+		}
+		h := configstate.Hub{Name: args[0], URL: urls[0], Endpoints: urls[1:], CAFile: hubAddCAFile, Insecure: hubAddInsecure}
+		if err := configstate.AddHub(h); err != nil {
+			return err
+		}
+		fmt.Printf("Added hub %q (%s). Log in with: moc login --hub %s\n", args[0], strings.Join(urls, ", "), args[0])
+		return nil
+	},
+}
+
+var hubURLsCmd = &cobra.Command{
+	Use:   "urls NAME URL [URL...]",
+	Short: "Replace the API endpoints of a hub (tried in the given order)",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		urls := configstate.SplitURLs(strings.Join(args[1:], ","))
+		if err := configstate.SetHubURLs(args[0], urls); err != nil {
+			return err
+		}
+		fmt.Printf("Hub %q endpoints: %s\n", args[0], strings.Join(urls, ", "))
+		return nil
+	},
+}
+
+var hubLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the hubs, the current one marked with *",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hubs, current, err := configstate.ListHubs()
+		if err != nil {
+			return err
+		}
+		if len(hubs) == 0 {
+			fmt.Println("No hubs configured; run 'moc login --hub <url>'.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(tw, "CURRENT\tNAME\tURL\tLAST ENDPOINT\tSESSION")
+		for _, h := range hubs {
+			mark := ""
+			if h.Name == current {
+				mark = "*"
+			}
+			session := "none"
+			withHub(h.Name, func() {
+				if identity.HasHubSession() {
+					session = "logged in"
+				}
+			})
+			urls := append([]string{h.URL}, h.Endpoints...)
+			last := h.LastURL
+			if last == "" {
+				last = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", mark, h.Name, strings.Join(urls, ","), last, session)
+		}
+		tw.Flush()
+		return nil
+	},
+}
+
+var hubUseCmd = &cobra.Command{
+	Use:   "use NAME",
+	Short: "Make a hub the current one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := configstate.UseHub(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Current hub is now %q.\n", args[0])
+		return nil
+	},
+}
+
+var hubRmCmd = &cobra.Command{
+	Use:   "rm NAME",
+	Short: "Log out of a hub and its clusters and forget it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		var err error
+		withHub(name, func() {
+			if _, err = configstate.LoadHubConfig(); err != nil {
+				return
+			}
+			// Same as "moc logout" for that hub; revocation failures do not keep the hub.
+			logoutClusters = nil
+			if lerr := logoutCmd.RunE(cmd, nil); lerr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", lerr)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if err := configstate.RemoveHub(name); err != nil {
+			return err
+		}
+		fmt.Printf("Removed hub %q.\n", name)
+		return nil
+	},
+}
+
+// withHub runs fn with the named hub active; the previous selection is restored afterwards.
+func withHub(name string, fn func()) {
+	prev := configstate.SetActiveHub(name)
+	defer configstate.SetActiveHub(prev)
+	fn()
+}
+
+// splitHubQualified splits "hub/cluster" into its parts; an unqualified name has no hub.
+func splitHubQualified(name string) (string, string) {
+	if hub, cluster, ok := strings.Cut(name, "/"); ok {
+		return hub, cluster
+	}
+	return "", name
+}
+
+// qualifiedHub strips the hub from "hub/cluster" names and returns the hub the run uses: the one
+// the names are qualified with, else hub (--hub). All qualified names must name the same hub, which
+// must match --hub if given.
+func qualifiedHub(names []string, hub string) ([]string, string, error) {
+	qualified := ""
+	out := make([]string, len(names))
+	for i, n := range names {
+		h, c := splitHubQualified(n)
+		if h != "" {
+			if qualified != "" && h != qualified {
+				return nil, "", fmt.Errorf("clusters of different hubs (%s, %s) cannot be combined in one call", qualified, h)
+			}
+			qualified = h
+		}
+		out[i] = c
+	}
+	switch {
+	case qualified == "":
+		return out, hub, nil
+	case hub != "" && hub != qualified:
+		return nil, "", fmt.Errorf("cluster names qualified with hub %s conflict with --hub %s", qualified, hub)
+	}
+	return out, qualified, nil
+}
+
+// findClusterHub looks for an unqualified cluster on the current hub first and then on every other
+// hub with a session; it selects the hub that knows the cluster. Finding it on several of the
+// other hubs is an error that asks for hub/cluster.
+func findClusterHub(ctx context.Context, clusterName string) (discovery.Cluster, error) {
+	cluster, err := discovery.GetCluster(ctx, clusterName)
+	var nf *discovery.NotFoundError
+	if err == nil || !errors.As(err, &nf) || configstate.HubSelected() {
+		return cluster, err
+	}
+	hubs, current, lerr := configstate.ListHubs()
+	if lerr != nil || len(hubs) < 2 {
+		return cluster, err
+	}
+	var found []string
+	var match discovery.Cluster
+	for _, h := range hubs {
+		if h.Name == current {
+			continue
+		}
+		withHub(h.Name, func() {
+			if !identity.HasHubSession() {
+				return
+			}
+			if c, err := discovery.GetCluster(ctx, clusterName); err == nil {
+				found = append(found, h.Name)
+				match = c
+			}
+		})
+	}
+	switch len(found) {
+	case 0:
+		return cluster, err
+	case 1:
+		fmt.Fprintf(os.Stderr, "Cluster %s found on hub %s.\n", clusterName, found[0])
+		return match, selectHub(found[0])
+	}
+	return discovery.Cluster{}, fmt.Errorf("cluster %s exists on several hubs (%s); use hub/cluster, e.g. %s/%s",
+		clusterName, strings.Join(found, ", "), found[0], clusterName)
+}
+
+// forEachHub runs fn once per configured hub with that hub active. Hubs without a session are
+// skipped with a warning, so that listing all hubs never prompts for logins.
+func forEachHub(fn func(h configstate.Hub) error) error {
+	hubs, _, err := configstate.ListHubs()
+	if err != nil {
+		return err
+	}
+	if len(hubs) == 0 {
+		return errors.New("no hubs configured; run 'moc login --hub <url>'")
+	}
+	for _, h := range hubs {
+		withHub(h.Name, func() {
+			if !identity.HasHubSession() {
+				fmt.Fprintf(os.Stderr, "Warning: skipping hub %s: not logged in (moc login --hub %s)\n", h.Name, h.Name)
+				return
+			}
+			if err := fn(h); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: hub %s: %v\n", h.Name, err)
+			}
+		})
+	}
+	return nil
+}
+
+// selectHub makes the named hub the active one for this run (--hub NAME).
+func selectHub(name string) error {
+	configstate.SetActiveHub(name)
+	_, err := configstate.LoadHubConfig()
+	return err
+}
+
+func init() {
+	hubAddCmd.Flags().StringVar(&hubAddCAFile, "ca-file", "", "Path to a CA file for the hub")
+	hubAddCmd.Flags().BoolVar(&hubAddInsecure, "insecure", false, "Skip TLS verification for the hub")
+	hubCmd.AddCommand(hubAddCmd, hubLsCmd, hubUseCmd, hubURLsCmd, hubRmCmd)
+	rootCmd.AddCommand(hubCmd)
+	rootCmd.PersistentFlags().StringVar(&hubName, "hub", "", "Use this hub instead of the current one (see 'moc hub ls')")
+}
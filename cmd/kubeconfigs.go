@@ -20,7 +20,7 @@ var kubeconfigsCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d kubeconfig(s) to ~/.config/multi-oc/kubeconfigs\n", n)
+		fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d kubeconfig(s) to ~/.config/multi-oc/kubeconfigs/<hub-id>\n", n)
 		return nil
 	},
 }
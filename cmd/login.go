@@ -1,15 +1,15 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"multi-oc/internal/configstate"
 	"multi-oc/internal/identity"
+	"multi-oc/internal/oauth"
+	"multi-oc/internal/prompt"
 
 	"github.com/spf13/cobra"
 )
@@ -20,20 +20,24 @@ var (
 	caFile   string
 	headless bool
 	token    string
+	username string
 )
 
 var loginCmd = &cobra.Command{
 	Use:   "login",
-	Short: "Login to the hub (headless token flow)",
-	Long:  "You will be prompted for the hub API URL (if not provided). A copyable OAuth URL is printed for token retrieval; paste the token to complete the login.",
+	Short: "Login to the hub (browser, password or token paste)",
+	Long:  "Logs into the hub given with --hub (a name from 'moc hub ls' or an API URL; a new URL is added as a hub) and makes it the current hub. Without --hub the current hub is used, or you are prompted for its API URL. With --username you are asked for your password; otherwise the login page opens in the browser. Without a display (or with --headless) a copyable OAuth URL is printed for token retrieval; paste the token to complete the login.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		reader := bufio.NewReader(os.Stdin)
-
-		// Prompt hub URL if not provided
+		// Without --hub: log into the active hub again, or ask for the URL of a first hub
 		if hubURL == "" {
-			fmt.Fprint(os.Stderr, "Hub API URL (e.g., https://api.hub.example:6443): ")
-			line, _ := reader.ReadString('\n')
-			hubURL = strings.TrimSpace(line)
+			hub, err := configstate.LoadHubConfig()
+			if err != nil {
+				return err
+			}
+			hubURL = hub.Name
+			if hubURL == "" {
+				hubURL = strings.TrimSpace(prompt.Line("Hub API URL (e.g., https://api.hub.example:6443): "))
+			}
 		}
 		// remove accidental leading '@'
 		hubURL = strings.TrimPrefix(hubURL, "@")
@@ -44,28 +48,38 @@ var loginCmd = &cobra.Command{
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 		defer cancel()
 
-		// Persist hub URL first
-		if err := configstate.SaveHub(hubURL); err != nil {
+		// Persist the hub first (a name or URL of a known hub, or a new URL) and make it current
+		name, err := configstate.SelectHub(hubURL)
+		if err != nil {
 			return err
 		}
-		// Bridge flags to env used by EnsureHubLogin
-		if insecure {
-			_ = os.Setenv("MOC_HUB_INSECURE", "true")
+		configstate.SetActiveHub(name)
+		// Flags win over the MOC_HUB_* environment
+		o := identity.LoginOptionsFromEnv()
+		if username != "" {
+			o.Username = username
 		}
 		if caFile != "" {
-			_ = os.Setenv("MOC_HUB_CA_FILE", caFile)
+			o.CAFile = caFile
+		}
+		if cmd.Flags().Changed("insecure") {
+			o.Insecure = &insecure
+		}
+		if headless {
+			ctx = oauth.WithHeadless(ctx)
 		}
-		// Always use headless EnsureHubLogin (prints OAuth URL and prompts for token)
-		return identity.EnsureHubLogin(ctx)
+		// Password login with --username, else browser login if possible, else paste flow
+		return identity.Login(ctx, o)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(loginCmd)
-	loginCmd.Flags().StringVar(&hubURL, "hub", "", "API URL of the hub cluster (https://api.hub:6443)")
+	loginCmd.Flags().StringVar(&hubURL, "hub", "", "Hub name or API URL of the hub cluster (https://api.hub:6443)")
 	loginCmd.Flags().BoolVar(&insecure, "insecure", false, "Skip TLS verification for the hub")
 	loginCmd.Flags().StringVar(&caFile, "ca-file", "", "Path to a CA file for the hub")
-	// Deprecated flags (kept for compatibility, no effect in headless flow):
-	loginCmd.Flags().BoolVar(&headless, "headless", false, "Deprecated (no-op): login is headless by default")
+	loginCmd.Flags().StringVarP(&username, "username", "u", "", "Log in with username and password (htpasswd/LDAP identity providers)")
+	loginCmd.Flags().BoolVar(&headless, "headless", false, "Do not open a browser; paste a token instead")
+	// Deprecated flags (kept for compatibility):
 	loginCmd.Flags().StringVar(&token, "token", "", "Deprecated (no-op): token will be prompted interactively")
 }
@@ -1,25 +1,154 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"time"
 
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/fanout"
+	"multi-oc/internal/hubkubeconfig"
 	"multi-oc/internal/identity"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/kubeexec"
 
 	"github.com/spf13/cobra"
 )
 
+var logoutClusters []string
+
 var logoutCmd = &cobra.Command{
 	Use:   "logout",
-	Short: "Remove stored credentials",
+	Short: "Revoke and remove stored credentials",
+	Long: `Revoke the OAuth access tokens server-side and remove all stored credentials: the hub session,
+every cached cluster token (keyring and file), fetched admin kubeconfigs and the discovery cache.
+With --cluster only the given clusters are logged out and the hub session is kept.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := identity.LogoutHub(); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		clusters, _, err := tokenClusters(ctx)
+		if err != nil {
 			return err
 		}
-		fmt.Println("Credentials removed (hub)")
+		byName := make(map[string]discovery.Cluster)
+		for _, c := range clusters {
+			byName[c.Name] = c
+		}
+		var targets []discovery.Cluster
+		if len(logoutClusters) > 0 {
+			for _, name := range logoutClusters {
+				c, ok := byName[name]
+				if !ok {
+					c = discovery.Cluster{Name: name}
+				}
+				targets = append(targets, c)
+			}
+		} else {
+			for _, c := range clusters {
+				if hasClusterToken(c.Name) {
+					targets = append(targets, c)
+				}
+			}
+		}
+
+		failed := logoutTargets(ctx, targets)
+		if len(logoutClusters) == 0 {
+			n, err := hubkubeconfig.RemoveAllKubeconfigs()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				fmt.Printf("Removed %d admin kubeconfig(s)\n", n)
+			}
+			if err := identity.LogoutHub(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "hub: token removed locally, but not revoked: %v\n", err)
+				failed++
+			} else {
+				fmt.Println("hub: logged out")
+			}
+			if err := discovery.ClearCache(); err != nil {
+				return err
+			}
+			if err := keystore.ResetEncryption(); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d token(s) could not be revoked server-side; they stay valid until they expire", failed)
+		}
 		return nil
 	},
 }
 
+// notRevocable describes a token that was removed locally but cannot be revoked on the server,
+// such as a service account token (JWT).
+const notRevocable = "removed (not revocable; expires on its own)"
+
+// logoutTargets revokes and removes the cached token and the fetched admin kubeconfig of every
+// cluster, printing one line per cluster. It returns the number of tokens that could not be revoked.
+func logoutTargets(ctx context.Context, clusters []discovery.Cluster) int {
+	lines := make([]string, len(clusters))
+	revokeFailed := make([]bool, len(clusters))
+	fanout.Each(len(clusters), fanout.DefaultParallel, func(i int) {
+		c := clusters[i]
+		msg := "nothing stored"
+		token, _ := keystore.GetTargetToken(c.Name)
+		switch {
+		case token == "":
+		case !kubeapi.Revocable(token):
+			msg = "token " + notRevocable
+		default:
+			var err error
+			if c.APIURL == "" {
+				err = fmt.Errorf("API URL unknown")
+			} else if client, cerr := kubeexec.TargetClient(c, token); cerr != nil {
+				err = cerr
+			} else {
+				err = client.RevokeToken(ctx)
+			}
+			if err != nil {
+				msg = fmt.Sprintf("token removed, but not revoked: %v", err)
+				revokeFailed[i] = true
+			} else {
+				msg = "token revoked and removed"
+			}
+		}
+		_ = keystore.DeleteTargetToken(c.Name)
+		if token, _ := keystore.GetTargetToken(keystore.MSAKey(c.Name)); token != "" {
+			// ManagedServiceAccount tokens are not OAuth tokens and cannot be revoked.
+			if msg == "nothing stored" {
+				msg = "service account token " + notRevocable
+			} else {
+				msg += "; service account token " + notRevocable
+			}
+		}
+		_ = keystore.DeleteTargetToken(keystore.MSAKey(c.Name))
+		if ok, err := hubkubeconfig.RemoveClusterKubeconfig(c.Name); err != nil {
+			msg += fmt.Sprintf("; removing admin kubeconfig failed: %v", err)
+		} else if ok {
+			if msg == "nothing stored" {
+				msg = "admin kubeconfig removed"
+			} else {
+				msg += "; admin kubeconfig removed"
+			}
+		}
+		lines[i] = msg
+	})
+	failed := 0
+	for i, c := range clusters {
+		fmt.Printf("%s: %s\n", c.Name, lines[i])
+		if revokeFailed[i] {
+			failed++
+		}
+	}
+	return failed
+}
+
 func init() {
+	logoutCmd.Flags().StringSliceVar(&logoutClusters, "cluster", nil, "Only log out of these clusters (repeatable or comma-separated)")
 	rootCmd.AddCommand(logoutCmd)
 }
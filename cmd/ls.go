@@ -3,39 +3,136 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"multi-oc/internal/configstate"
 	"multi-oc/internal/discovery"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	lsSelector      string
+	lsClusterSet    string
+	lsShowLabels    bool
+	lsAvailableOnly bool
+	lsAllHubs       bool
+)
+
 var lsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List available clusters (from the hub)",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		clusters, err := discovery.ListManagedClusters(ctx)
-		if err != nil {
-			return err
+		var clusters []discovery.Cluster
+		var hubOf []string
+		if lsAllHubs {
+			err := forEachHub(func(h configstate.Hub) error {
+				cs, err := listSelected(ctx)
+				for range cs {
+					hubOf = append(hubOf, h.Name)
+				}
+				clusters = append(clusters, cs...)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if clusters, err = listSelected(ctx); err != nil {
+				return err
+			}
 		}
 		if len(clusters) == 0 {
 			fmt.Println("No clusters found.")
 			return nil
 		}
-		for _, c := range clusters {
-			var extras []string
-			if c.APIURL != "" {
-				extras = append(extras, c.APIURL)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		header := "NAME\tAVAILABLE\tJOINED\tACCEPTED\tLEASE\tAPI URL"
+		if lsShowLabels {
+			header += "\tLABELS"
+		}
+		if lsAllHubs {
+			header = "HUB\t" + header
+		}
+		fmt.Fprintln(tw, header)
+		for i, c := range clusters {
+			fields := []string{
+				c.Name,
+				orUnknown(c.Status.Available),
+				orUnknown(c.Status.Joined),
+				orUnknown(c.Status.Accepted),
+				leaseState(c),
+				orUnknown(c.APIURL),
+			}
+			if lsShowLabels {
+				fields = append(fields, formatLabels(c.Labels))
+			}
+			if lsAllHubs {
+				fields = append([]string{hubOf[i]}, fields...)
 			}
-			fmt.Printf("%s\t%s\n", c.Name, strings.Join(extras, " "))
+			fmt.Fprintln(tw, strings.Join(fields, "\t"))
 		}
+		tw.Flush()
 		return nil
 	},
 }
 
+// listSelected lists the clusters of the active hub that match the ls flags.
+func listSelected(ctx context.Context) ([]discovery.Cluster, error) {
+	clusters, err := discovery.ListManagedClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClusterSet(ctx, lsClusterSet); err != nil {
+		return nil, err
+	}
+	return selectClusters(clusters, targetOptions{selector: lsSelector, clusterSet: lsClusterSet, availableOnly: lsAvailableOnly})
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "Unknown"
+	}
+	return s
+}
+
+// leaseState shows whether the cluster agent keeps renewing its lease on the hub.
+func leaseState(c discovery.Cluster) string {
+	switch {
+	case c.LeaseStopped():
+		return "Stopped"
+	case c.IsAvailable():
+		return "OK"
+	default:
+		return "Unknown"
+	}
+}
+
+// formatLabels renders labels like "oc get --show-labels" does.
+func formatLabels(lbls map[string]string) string {
+	if len(lbls) == 0 {
+		return "<none>"
+	}
+	pairs := make([]string, 0, len(lbls))
+	for k, v := range lbls {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 func init() {
 	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().StringVarP(&lsSelector, "selector", "l", "", "Label selector (e.g. env=prod,region!=eu)")
+	lsCmd.Flags().StringVar(&lsClusterSet, "clusterset", "", "Only list members of this ManagedClusterSet")
+	lsCmd.Flags().BoolVar(&lsAvailableOnly, "available-only", false, "Only list clusters the hub reports as available")
+	lsCmd.Flags().BoolVar(&lsShowLabels, "show-labels", false, "Show cluster labels")
+	lsCmd.Flags().BoolVar(&lsAllHubs, "all-hubs", false, "List the clusters of every hub with a session")
 }
@@ -3,6 +3,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/keystore"
 
 	"github.com/spf13/cobra"
 )
@@ -15,33 +21,146 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() error {
+	keystore.SetClusterLabels(cachedLabels)
 	return rootCmd.Execute()
 }
 
+var labelCache struct {
+	sync.Mutex
+	hubID  string
+	labels map[string]map[string]string
+}
+
+// cachedLabels returns the labels of a cluster of the active hub from the discovery cache,
+// without contacting the hub. The cache is read once per hub and run.
+func cachedLabels(clusterName string) map[string]string {
+	id, err := configstate.HubID()
+	if err != nil {
+		return nil
+	}
+	labelCache.Lock()
+	defer labelCache.Unlock()
+	if labelCache.labels == nil || labelCache.hubID != id {
+		labelCache.hubID, labelCache.labels = id, make(map[string]map[string]string)
+		for _, c := range discovery.CachedClusters() {
+			labelCache.labels[c.Name] = c.Labels
+		}
+	}
+	return labelCache.labels[clusterName]
+}
+
+// IsSubcommand reports whether args run a moc subcommand rather than a cluster name or target
+// flag. Persistent flags of moc itself may come first, as in "moc --hub lab ls".
+func IsSubcommand(args []string) bool {
+	args = skipRootFlags(args)
+	if len(args) == 0 {
+		return false
+	}
+	name := args[0]
+	switch name {
+	case "help", "completion", "-h", "--help":
+		return true
+	}
+	for _, c := range rootCmd.Commands() {
+		if c == execCmd {
+			continue
+		}
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipRootFlags returns args without their leading persistent flags of the root command.
+func skipRootFlags(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(args[0], "--"), "=")
+		f := rootCmd.PersistentFlags().Lookup(name)
+		switch {
+		case f == nil:
+			return args
+		case hasValue || f.NoOptDefVal != "":
+			args = args[1:]
+		case len(args) > 1:
+			args = args[2:]
+		default:
+			return nil
+		}
+	}
+	return args
+}
+
 func init() {
 	cobra.OnInitialize(func() {
 		_ = os.Setenv("LANG", "C")
 	})
 
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Report a broken config.yaml up front, except to the commands that repair it
+		if cmd.Parent() != configCmd {
+			if _, err := configstate.LoadConfig(); err != nil {
+				return err
+			}
+		}
+		// "moc login --hub" has its own flag (name or URL) that shadows this one
+		if hubName != "" {
+			return selectHub(hubName)
+		}
 		return nil
 	}
 
 	rootCmd.SetHelpTemplate(fmt.Sprintf(`Usage:
   %s [cluster|command] [args...]
+  %s --clusters a,b,c|--all|-l selector|--clusterset name|--placement ns/name [target flags] [oc args...]
 
 Commands:
   login           Login to the hub (SSO)
-  ls              List available clusters
-  logout          Remove stored credentials
+  hub             Add, list, switch and remove hubs (add|ls|use|urls|rm)
+  ls              List available clusters (--all-hubs for every hub)
+  logout          Revoke and remove stored credentials (--cluster to scope)
+  tokens          List/remove/set/refresh cached cluster tokens, choose the backend
+  config          Show and change settings, globally, per cluster or per label (view|get|set)
+  whoami          Show who the hub/cluster tokens belong to and when they expire
   version         Show version and credits
 
+Target flags (before the oc arguments):
+      --hub NAME         Use this hub instead of the current one (or name clusters hub/cluster)
+  -c, --clusters a,b,c   Run on the given clusters in parallel
+      --all              Run on all managed clusters
+  -l, --selector SEL     Run on clusters matching a label selector (env=prod,region!=eu)
+      --clusterset NAME  Run on the members of a ManagedClusterSet
+      --placement NS/NAME
+                         Run on the clusters chosen by an ACM Placement
+      --available-only   Skip clusters the hub does not report as available
+  -P, --parallel N       Maximum concurrent oc calls (default 10)
+  -u, --username USER    Get missing tokens with username/password instead of pasting them
+      --reuse-password   Ask for the password once and use it for every cluster
+      --headless         Never open a browser for logins; paste tokens instead
+      --api-url-prefer RE
+                         Try cluster API URLs matching RE first (clusters with several URLs)
+      --api-url-index N  Always use the N-th API URL of each cluster (from 0)
+      --auth msa         Use ManagedServiceAccount tokens from the hub (no per-cluster login)
+  -b, --collapse         Print identical outputs once, grouped by cluster
+
 Examples:
   moc login --hub https://api.hub.example:6443
+  moc hub add prod https://api.vip.example:6443 https://api.site2.example:6443
+  moc -u alice --reuse-password --all get nodes
   moc ls
+  moc whoami --all
+  moc --auth msa --all get nodes
+  moc tokens refresh --missing
+  moc config set requestTimeout 2m -l env=prod
   moc cluster1 get nodes
+  moc lab/cluster1 get nodes
+  moc --clusters cluster1,cluster2 get nodes
+  moc --all get clusterversion
+  moc -l env=prod get nodes
+  moc --placement rollout/wave-1 get clusterversion
+  moc --all --collapse get cm my-flags -n app -o jsonpath='{.data}'
 
 Credits:
   Thorsten Stremetzne, People Visions & Magic LLP - https://github.com/PVMLLP/multi-oc
-`, rootCmd.Use))
+`, rootCmd.Use, rootCmd.Use))
 }
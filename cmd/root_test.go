@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestIsSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"ls"}, true},
+		{[]string{"--help"}, true},
+		{[]string{"--hub", "lab", "ls"}, true},
+		{[]string{"--hub=lab", "tokens", "ls"}, true},
+		{[]string{"--hub", "lab", "c1", "get", "pods"}, false},
+		{[]string{"--hub", "lab", "--all", "get", "pods"}, false},
+		{[]string{"--hub", "lab"}, false},
+		{[]string{"c1", "get", "pods"}, false},
+		{[]string{"-c", "ls"}, false},
+	}
+	for _, tt := range tests {
+		if got := IsSubcommand(tt.args); got != tt.want {
+			t.Errorf("IsSubcommand(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/fanout"
+	"multi-oc/internal/kubeexec"
+	"multi-oc/internal/labels"
+	"multi-oc/internal/oauth"
+)
+
+// targetOptions are the moc flags accepted in direct invocations
+// (moc [flags] <cluster> [oc args...]). They must precede the oc arguments.
+type targetOptions struct {
+	clusters   []string
+	all        bool
+	selector   string
+	clusterSet string
+	placement  string
+	parallel   int
+	collapse   bool
+	// availableOnly skips clusters the hub does not report as available.
+	availableOnly bool
+	// hub is the hub named with --hub; "" means MOC_HUB or the current hub.
+	hub string
+	// headless never opens a browser for logins (MOC_HEADLESS is the fallback).
+	headless bool
+	// exec chooses credentials and API URLs of the clusters.
+	exec kubeexec.Options
+}
+
+// fanout reports whether the invocation targets a set of clusters rather than a single positional cluster.
+func (o targetOptions) fanout() bool {
+	return o.all || len(o.clusters) > 0 || o.selector != "" || o.clusterSet != "" || o.placement != ""
+}
+
+// context applies the options that also concern logins deep in the run (--headless) to ctx.
+func (o targetOptions) context(ctx context.Context) context.Context {
+	if o.headless {
+		return oauth.WithHeadless(ctx)
+	}
+	return ctx
+}
+
+type directFlag struct {
+	names      []string
+	takesValue bool
+	apply      func(o *targetOptions, v string) error
+}
+
+var directFlags = []directFlag{
+	{names: []string{"--clusters", "-c"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				o.clusters = append(o.clusters, name)
+			}
+		}
+		return nil
+	}},
+	{names: []string{"--all"}, apply: func(o *targetOptions, v string) error {
+		o.all = true
+		return nil
+	}},
+	{names: []string{"--selector", "-l"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		if _, err := labels.Parse(v); err != nil {
+			return err
+		}
+		o.selector = v
+		return nil
+	}},
+	{names: []string{"--clusterset"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		o.clusterSet = strings.TrimSpace(v)
+		return nil
+	}},
+	{names: []string{"--placement"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		if _, _, err := discovery.ParsePlacementRef(v); err != nil {
+			return err
+		}
+		o.placement = v
+		return nil
+	}},
+	{names: []string{"--collapse", "-b"}, apply: func(o *targetOptions, v string) error {
+		o.collapse = true
+		return nil
+	}},
+	{names: []string{"--available-only", "--skip-unavailable"}, apply: func(o *targetOptions, v string) error {
+		o.availableOnly = true
+		return nil
+	}},
+	// Credentials for clusters without a cached token
+	{names: []string{"--username", "-u"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		o.exec.Username = strings.TrimSpace(v)
+		return nil
+	}},
+	{names: []string{"--reuse-password"}, apply: func(o *targetOptions, v string) error {
+		o.exec.ReusePassword = true
+		return nil
+	}},
+	{names: []string{"--headless"}, apply: func(o *targetOptions, v string) error {
+		o.headless = true
+		return nil
+	}},
+	{names: []string{"--hub"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		if v = strings.TrimSpace(v); v == "" {
+			return fmt.Errorf("--hub expects a hub name")
+		}
+		o.hub = v
+		return nil
+	}},
+	// API URL choice for clusters with several managedClusterClientConfigs (see kubeexec.SelectEndpoint)
+	{names: []string{"--api-url-index"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		return o.exec.SetAPIURLIndex(v)
+	}},
+	{names: []string{"--api-url-prefer"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		return o.exec.SetAPIURLPrefer(v)
+	}},
+	{names: []string{"--auth"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		return o.exec.SetAuth(v)
+	}},
+	{names: []string{"--parallel", "-P"}, takesValue: true, apply: func(o *targetOptions, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("--parallel expects a positive number, got %q", v)
+		}
+		o.parallel = n
+		return nil
+	}},
+}
+
+// parseDirectArgs consumes leading moc flags and returns them together with the remaining arguments.
+// Parsing stops at the first non-flag argument or at "--". Options without a flag keep the values
+// from the environment (kubeexec.OptionsFromEnv).
+func parseDirectArgs(args []string) (targetOptions, []string, error) {
+	execOpts, err := kubeexec.OptionsFromEnv()
+	if err != nil {
+		return targetOptions{}, nil, err
+	}
+	opts := targetOptions{parallel: fanout.DefaultParallel, exec: execOpts}
+	i := 0
+	for i < len(args) {
+		a := args[i]
+		if a == "--" {
+			i++
+			break
+		}
+		if !strings.HasPrefix(a, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(a, "=")
+		f := lookupDirectFlag(name)
+		if f == nil {
+			return opts, nil, fmt.Errorf("unknown moc flag %s (oc flags must follow the cluster name or the oc command)", name)
+		}
+		if f.takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("flag %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := f.apply(&opts, value); err != nil {
+			return opts, nil, err
+		}
+		i++
+	}
+	return opts, args[i:], nil
+}
+
+func lookupDirectFlag(name string) *directFlag {
+	for i := range directFlags {
+		for _, n := range directFlags[i].names {
+			if n == name {
+				return &directFlags[i]
+			}
+		}
+	}
+	return nil
+}
+
+// resolveTargets turns the targeting flags into a list of discovered clusters.
+func resolveTargets(ctx context.Context, opts targetOptions) ([]discovery.Cluster, error) {
+	clusters, err := discovery.ListManagedClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClusterSet(ctx, opts.clusterSet); err != nil {
+		return nil, err
+	}
+	if opts.placement == "" {
+		return selectClusters(clusters, opts)
+	}
+	ns, name, err := discovery.ParsePlacementRef(opts.placement)
+	if err != nil {
+		return nil, err
+	}
+	decided, err := discovery.PlacementClusters(ctx, ns, name)
+	if err != nil {
+		return nil, err
+	}
+	// Decisions may name clusters that joined after the cache was written: read the hub once more
+	if len(unknownClusters(decided, clusters)) > 0 {
+		if clusters, err = discovery.RefreshManagedClusters(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range unknownClusters(decided, clusters) {
+		fmt.Fprintf(os.Stderr, "Warning: Placement %s selects cluster %s, which is not visible on the hub; skipping it\n", opts.placement, n)
+	}
+	selected, err := selectClusters(clusters, opts)
+	if err != nil {
+		return nil, err
+	}
+	return filterByPlacement(selected, decided), nil
+}
+
+// unknownClusters returns the names that are not among the discovered clusters.
+func unknownClusters(names []string, clusters []discovery.Cluster) []string {
+	known := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		known[c.Name] = true
+	}
+	var unknown []string
+	for _, n := range names {
+		if !known[n] {
+			unknown = append(unknown, n)
+		}
+	}
+	return unknown
+}
+
+// filterByPlacement keeps the selected clusters that the Placement decided on.
+func filterByPlacement(selected []discovery.Cluster, decided []string) []discovery.Cluster {
+	inPlacement := make(map[string]bool, len(decided))
+	for _, n := range decided {
+		inPlacement[n] = true
+	}
+	result := make([]discovery.Cluster, 0, len(decided))
+	for _, c := range selected {
+		if inPlacement[c.Name] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// checkClusterSet returns an error if name is set but not a known ManagedClusterSet.
+func checkClusterSet(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+	sets, err := discovery.ListClusterSets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range sets {
+		if s == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("ManagedClusterSet %s not found", name)
+}
+
+// selectClusters applies the targeting flags to a list of clusters.
+// Explicit names are taken in the given order; clusterset, label selector and availability
+// narrow the result further.
+// Without explicit names, all clusters are candidates.
+func selectClusters(clusters []discovery.Cluster, opts targetOptions) ([]discovery.Cluster, error) {
+	sel, err := labels.Parse(opts.selector)
+	if err != nil {
+		return nil, err
+	}
+	candidates := clusters
+	if len(opts.clusters) > 0 && !opts.all {
+		byName := make(map[string]discovery.Cluster, len(clusters))
+		for _, c := range clusters {
+			byName[c.Name] = c
+		}
+		seen := make(map[string]bool, len(opts.clusters))
+		candidates = make([]discovery.Cluster, 0, len(opts.clusters))
+		for _, name := range opts.clusters {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			c, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("Cluster %s not found", name)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	result := make([]discovery.Cluster, 0, len(candidates))
+	for _, c := range candidates {
+		if opts.clusterSet != "" && !inClusterSet(c, opts.clusterSet) {
+			continue
+		}
+		if opts.availableOnly && !c.IsAvailable() {
+			continue
+		}
+		if sel.Matches(c.Labels) {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func inClusterSet(c discovery.Cluster, name string) bool {
+	for _, s := range c.ClusterSets {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
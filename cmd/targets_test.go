@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/kubeexec"
+)
+
+func TestParseDirectArgs(t *testing.T) {
+	opts, rest, err := parseDirectArgs([]string{"--hub", "lab", "--auth=msa", "-l", "env=prod", "--headless",
+		"--api-url-index", "1", "-P", "3", "get", "nodes", "--all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.hub != "lab" || opts.exec.Auth != kubeexec.AuthMSA || opts.selector != "env=prod" || !opts.headless ||
+		opts.exec.APIURLIndex != 1 || opts.parallel != 3 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if opts.all {
+		t.Error("--all after the oc command must be passed to oc")
+	}
+	if want := []string{"get", "nodes", "--all"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %q, want %q", rest, want)
+	}
+}
+
+func TestParseDirectArgsEnvFallback(t *testing.T) {
+	t.Setenv("MOC_TARGET_AUTH", "msa")
+	t.Setenv("MOC_TARGET_USERNAME", "alice")
+	t.Setenv("MOC_API_URL_PREFER", "internal")
+
+	opts, _, err := parseDirectArgs([]string{"--auth", "user", "c1", "get", "nodes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.exec.Auth != kubeexec.AuthUser {
+		t.Errorf("flag must win over MOC_TARGET_AUTH, got %q", opts.exec.Auth)
+	}
+	if opts.exec.Username != "alice" || opts.exec.APIURLPrefer == nil || opts.exec.APIURLIndex != -1 {
+		t.Errorf("environment fallback not applied: %+v", opts.exec)
+	}
+}
+
+func TestParseDirectArgsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--auth", "kerberos", "c1"},
+		{"--api-url-index", "-1", "c1"},
+		{"--api-url-prefer", "(", "c1"},
+		{"--parallel", "0", "c1"},
+		{"--hub", " ", "c1"},
+		{"--selector"},
+		{"--no-such-flag", "c1"},
+	} {
+		if _, _, err := parseDirectArgs(args); err == nil {
+			t.Errorf("parseDirectArgs(%q): expected an error", args)
+		}
+	}
+}
+
+func TestQualifiedHub(t *testing.T) {
+	names, hub, err := qualifiedHub([]string{"lab/c1", "c2"}, "")
+	if err != nil || hub != "lab" || !reflect.DeepEqual(names, []string{"c1", "c2"}) {
+		t.Errorf("got %q, %q, %v", names, hub, err)
+	}
+	if _, hub, err := qualifiedHub([]string{"c1"}, "prod"); err != nil || hub != "prod" {
+		t.Errorf("--hub without qualified names: got %q, %v", hub, err)
+	}
+	if _, _, err := qualifiedHub([]string{"lab/c1", "prod/c2"}, ""); err == nil {
+		t.Error("clusters of two hubs must be rejected")
+	}
+	if _, _, err := qualifiedHub([]string{"lab/c1"}, "prod"); err == nil {
+		t.Error("a qualified name conflicting with --hub must be rejected")
+	}
+}
+
+func TestSelectClusters(t *testing.T) {
+	clusters := []discovery.Cluster{
+		{Name: "c1", Labels: map[string]string{"env": "prod"}, ClusterSets: []string{"a"}},
+		{Name: "c2", Labels: map[string]string{"env": "dev"}, ClusterSets: []string{"a"}},
+		{Name: "c3", Labels: map[string]string{"env": "prod"}},
+	}
+	got, err := selectClusters(clusters, targetOptions{selector: "env=prod", clusterSet: "a"})
+	if err != nil || len(got) != 1 || got[0].Name != "c1" {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := selectClusters(clusters, targetOptions{clusters: []string{"c4"}}); err == nil {
+		t.Error("unknown explicit cluster must be an error")
+	}
+}
+
+func TestFilterByPlacement(t *testing.T) {
+	clusters := []discovery.Cluster{{Name: "c1"}, {Name: "c2"}, {Name: "c3"}}
+	decided := []string{"c3", "c1", "c9"}
+	if got := unknownClusters(decided, clusters); !reflect.DeepEqual(got, []string{"c9"}) {
+		t.Errorf("unknownClusters = %q", got)
+	}
+	got := filterByPlacement(clusters, decided)
+	if len(got) != 2 || got[0].Name != "c1" || got[1].Name != "c3" {
+		t.Errorf("filterByPlacement = %v", got)
+	}
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/identity"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeexec"
+	"multi-oc/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokensCheck           bool
+	tokensRmAll           bool
+	tokensMissing         bool
+	tokensExpired         bool
+	tokensBackendClusters []string
+	tokensBackendUnset    bool
+)
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "List and manage the cached cluster tokens",
+}
+
+var tokensLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached tokens with backend, age, expiry and validity",
+	Long: `List every discovered cluster and every cluster with a cached token.
+Validity is taken from the recorded metadata; --check asks each cluster live.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		clusters, discovered, err := tokenClusters(ctx)
+		if err != nil {
+			return err
+		}
+		var checked []whoamiRow
+		if tokensCheck {
+			var known []discovery.Cluster
+			for _, c := range clusters {
+				if discovered[c.Name] {
+					known = append(known, c)
+				}
+			}
+			checked = whoamiClusters(ctx, known, kubeexec.AuthUser)
+		}
+		status := make(map[string]string)
+		for _, r := range checked {
+			status[r.name] = r.status
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tBACKEND\tUSER\tAGE\tEXPIRES\tSTATUS")
+		now := time.Now()
+		for _, c := range clusters {
+			info, _, _ := keystore.GetTargetTokenInfo(c.Name)
+			backend := keystore.TargetTokenBackend(c.Name)
+			if kubeexec.HasKubeconfig(c.Name) {
+				backend = "kubeconfig"
+			}
+			st, ok := status[c.Name]
+			if !ok {
+				st = localTokenStatus(backend, info, now)
+				if !discovered[c.Name] {
+					st += " (not on hub)"
+				}
+			}
+			if backend == "" {
+				backend = "-"
+				info = keystore.TokenInfo{}
+			}
+			printTokenRow(tw, c.Name, backend, info, st, now)
+
+			// A ManagedServiceAccount token is kept apart and listed in a row of its own.
+			key := keystore.MSAKey(c.Name)
+			if backend := keystore.TargetTokenBackend(key); backend != "" {
+				info, _, _ := keystore.GetTargetTokenInfo(key)
+				printTokenRow(tw, c.Name+" (msa)", backend, info, localTokenStatus(backend, info, now), now)
+			}
+		}
+		return tw.Flush()
+	},
+}
+
+func printTokenRow(w io.Writer, name, backend string, info keystore.TokenInfo, status string, now time.Time) {
+	age := "-"
+	if !info.ObtainedAt.IsZero() {
+		age = output.HumanDuration(now.Sub(info.ObtainedAt))
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, backend, orDash(info.User), age, expiresIn(info.ExpiresAt, now), status)
+}
+
+// hasClusterToken reports whether a token of the user or a ManagedServiceAccount token is
+// stored for the cluster.
+func hasClusterToken(name string) bool {
+	return keystore.TargetTokenBackend(name) != "" || keystore.TargetTokenBackend(keystore.MSAKey(name)) != ""
+}
+
+var tokensRmCmd = &cobra.Command{
+	Use:   "rm <cluster>...|--all",
+	Short: "Remove cached tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tokensRmAll == (len(args) > 0) {
+			return fmt.Errorf("pass cluster names or --all")
+		}
+		names := args
+		if tokensRmAll {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			clusters, _, err := tokenClusters(ctx)
+			if err != nil {
+				return err
+			}
+			names = nil
+			for _, c := range clusters {
+				if hasClusterToken(c.Name) {
+					names = append(names, c.Name)
+				}
+			}
+		}
+		for _, name := range names {
+			if err := keystore.DeleteTargetToken(name); err != nil {
+				return err
+			}
+			if err := keystore.DeleteTargetToken(keystore.MSAKey(name)); err != nil {
+				return err
+			}
+			fmt.Printf("Removed token for cluster %s\n", name)
+		}
+		if len(names) == 0 {
+			fmt.Println("No tokens stored.")
+		}
+		return nil
+	},
+}
+
+var tokensSetCmd = &cobra.Command{
+	Use:   "set <cluster>",
+	Short: "Store a token for a cluster, read from stdin",
+	Long: `Store a token for a cluster without prompting, e.g.:
+  echo "$TOKEN" | moc tokens set cluster1
+The token is checked against the cluster and not stored if it is rejected.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		c, err := discovery.GetCluster(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		in, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if _, err := kubeexec.StoreToken(ctx, c, c.Name, string(in)); err != nil {
+			return err
+		}
+		info, _, _ := keystore.GetTargetTokenInfo(c.Name)
+		if info.User != "" {
+			fmt.Printf("Stored token for cluster %s (user %s, expires %s)\n", c.Name, info.User, expiresIn(info.ExpiresAt, time.Now()))
+		} else {
+			fmt.Printf("Stored token for cluster %s (not checked)\n", c.Name)
+		}
+		return nil
+	},
+}
+
+var tokensRefreshCmd = &cobra.Command{
+	Use:   "refresh --missing|--expired",
+	Short: "Collect missing or expired tokens for all discovered clusters in one go",
+	Long: `Walk the discovered clusters and prompt for every token that is missing (--missing),
+expired or rejected (--expired). Without flags both are collected.
+Clusters using a kubeconfig or MOC_TARGET_TOKEN are skipped.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		missing, expired := tokensMissing, tokensExpired
+		if !missing && !expired {
+			missing, expired = true, true
+		}
+		execOpts, err := kubeexec.OptionsFromEnv()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+		clusters, err := discovery.ListManagedClusters(ctx)
+		if err != nil {
+			return err
+		}
+		var candidates []discovery.Cluster
+		for _, c := range clusters {
+			if c.APIURL != "" && kubeexec.CanRefreshToken(c) {
+				candidates = append(candidates, c)
+			}
+		}
+
+		var todo []discovery.Cluster
+		reasons := make(map[string]string)
+		rows := whoamiClusters(ctx, candidates, execOpts.Auth)
+		for i, r := range rows {
+			switch {
+			case missing && r.status == statusNoToken,
+				expired && (r.status == statusExpired || r.status == statusRejected):
+				todo = append(todo, candidates[i])
+				reasons[r.name] = r.status
+			}
+		}
+		if len(todo) == 0 {
+			fmt.Println("All tokens are present and valid.")
+			return nil
+		}
+
+		failed := 0
+		for i, c := range todo {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s (%s)\n", i+1, len(todo), c.Name, reasons[c.Name])
+			if _, err := kubeexec.PromptToken(ctx, c, execOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name, err)
+				failed++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Refreshed %d of %d token(s)\n", len(todo)-failed, len(todo))
+		if failed > 0 {
+			return fmt.Errorf("%d token(s) not refreshed", failed)
+		}
+		return nil
+	},
+}
+
+// tokenClusters returns the discovered clusters plus clusters that only have a cached token,
+// sorted by name, and which of them are known to the hub. Without a hub session the discovery
+// cache is used as is, so that no hub login is prompted for.
+func tokenClusters(ctx context.Context) ([]discovery.Cluster, map[string]bool, error) {
+	var clusters []discovery.Cluster
+	if identity.HasHubSession() {
+		var err error
+		if clusters, err = discovery.ListManagedClusters(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cluster discovery failed, listing cached tokens only: %v\n", err)
+			clusters = discovery.CachedClusters()
+		}
+	} else {
+		clusters = discovery.CachedClusters()
+	}
+	discovered := make(map[string]bool)
+	for _, c := range clusters {
+		discovered[c.Name] = true
+	}
+	stored, err := keystore.ListTargetTokens()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range stored {
+		if !discovered[name] {
+			clusters = append(clusters, discovery.Cluster{Name: name})
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters, discovered, nil
+}
+
+var tokensLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Forget the unlocked passphrase of the encrypted token store",
+	Long: `Remove the session-cached key of a passphrase-encrypted token store
+(MOC_TOKEN_ENCRYPTION=passphrase). The next command that needs a token asks
+for the passphrase again.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := keystore.Lock(); err != nil {
+			return err
+		}
+		fmt.Println("Token store locked.")
+		return nil
+	},
+}
+
+var tokensBackendCmd = &cobra.Command{
+	Use:   "backend [auto|keyring|file|encrypted|pass|vault|helper[:<command>]]",
+	Short: "Show or set the credential backend, globally or per cluster",
+	Long: `Without arguments, show the configured credential backends. With a backend name,
+set it for all tokens, or with --cluster only for those clusters (the hub token
+always uses the global backend). --unset removes the setting again.
+Tokens already stored are moved to the new backend. The settings are kept as
+credentialBackend in config.yaml, where label rules may set it as well (see 'moc config').`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !tokensBackendUnset {
+			return printBackends()
+		}
+		spec := ""
+		if len(args) == 1 {
+			if tokensBackendUnset {
+				return fmt.Errorf("pass a backend or --unset, not both")
+			}
+			if _, err := keystore.ParseBackend(args[0]); err != nil {
+				return err
+			}
+			spec = args[0]
+		}
+
+		// Remember where every stored token is now, so it can be moved after the change.
+		hub, _ := configstate.LoadHubConfig()
+		names, err := keystore.ListTargetTokens()
+		if err != nil {
+			return err
+		}
+		before := make(map[string]keystore.Backend)
+		for _, name := range names {
+			if b, err := keystore.BackendFor(name); err == nil {
+				before[name] = b
+			}
+		}
+		hubBefore, hubErr := keystore.BackendFor("")
+
+		if len(tokensBackendClusters) == 0 {
+			if err := configstate.SetCredentialBackend("", spec); err != nil {
+				return err
+			}
+		}
+		for _, name := range tokensBackendClusters {
+			if err := configstate.SetCredentialBackend(name, spec); err != nil {
+				return err
+			}
+		}
+		if os.Getenv("MOC_CREDENTIAL_BACKEND") != "" {
+			fmt.Fprintln(os.Stderr, "Note: MOC_CREDENTIAL_BACKEND is set and overrides this setting.")
+		}
+
+		for _, name := range names {
+			from, ok := before[name]
+			if !ok || !backendChanged(from, name) {
+				continue
+			}
+			if err := keystore.MoveTargetToken(name, from); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: token not moved: %v\n", name, err)
+				continue
+			}
+			fmt.Printf("Moved token for cluster %s to %s\n", name, keystore.BackendSpec(name))
+		}
+		if hub.URL != "" && hubErr == nil && backendChanged(hubBefore, "") {
+			if err := keystore.MoveHubToken(hubBefore); err != nil {
+				fmt.Fprintf(os.Stderr, "hub: token not moved: %v\n", err)
+			}
+		}
+		return printBackends()
+	},
+}
+
+// backendChanged reports whether the configured backend for a cluster ("" for the hub) is no
+// longer the one a token was stored in.
+func backendChanged(from keystore.Backend, clusterName string) bool {
+	to, err := keystore.BackendFor(clusterName)
+	return err == nil && to != from
+}
+
+func printBackends() error {
+	global, perCluster, err := configstate.CredentialBackends()
+	if err != nil {
+		return err
+	}
+	if v := os.Getenv("MOC_CREDENTIAL_BACKEND"); v != "" {
+		fmt.Printf("MOC_CREDENTIAL_BACKEND=%s (overrides the settings below)\n", v)
+	}
+	fmt.Printf("global: %s\n", orDefault(global, "auto"))
+	names := make([]string, 0, len(perCluster))
+	for name := range perCluster {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %s\n", name, perCluster[name])
+	}
+	return nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// localTokenStatus describes a token from its recorded metadata only, without asking the cluster.
+func localTokenStatus(backend string, info keystore.TokenInfo, now time.Time) string {
+	switch {
+	case backend == "kubeconfig":
+		return "-"
+	case backend == "":
+		return statusNoToken
+	case info.Expired(now):
+		return statusExpired
+	case !info.ValidatedAt.IsZero():
+		return fmt.Sprintf("valid (checked %s ago)", output.HumanDuration(now.Sub(info.ValidatedAt)))
+	}
+	return "unchecked"
+}
+
+func init() {
+	tokensLsCmd.Flags().BoolVar(&tokensCheck, "check", false, "Validate each token live against its cluster")
+	tokensRmCmd.Flags().BoolVar(&tokensRmAll, "all", false, "Remove all cached tokens")
+	tokensRefreshCmd.Flags().BoolVar(&tokensMissing, "missing", false, "Prompt for clusters without a token")
+	tokensRefreshCmd.Flags().BoolVar(&tokensExpired, "expired", false, "Prompt for clusters whose token expired or was rejected")
+	tokensBackendCmd.Flags().StringSliceVar(&tokensBackendClusters, "cluster", nil, "Only for these clusters (repeatable or comma-separated)")
+	tokensBackendCmd.Flags().BoolVar(&tokensBackendUnset, "unset", false, "Remove the setting (back to the global backend, or auto)")
+	tokensCmd.AddCommand(tokensLsCmd, tokensRmCmd, tokensSetCmd, tokensRefreshCmd, tokensLockCmd, tokensBackendCmd)
+	rootCmd.AddCommand(tokensCmd)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/fanout"
+	"multi-oc/internal/identity"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/kubeexec"
+	"multi-oc/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+var whoamiAll bool
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami [cluster|--all]",
+	Short: "Show the user behind the hub or cluster tokens and when they expire",
+	Long: `Show the user and groups each cached token authenticates as, and when it expires.
+Without arguments the hub session is shown. Tokens are checked live; nothing is prompted for.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if whoamiAll && len(args) > 0 {
+			return fmt.Errorf("pass either a cluster name or --all")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		var rows []whoamiRow
+		switch {
+		case whoamiAll:
+			clusters, err := discovery.ListManagedClusters(ctx)
+			if err != nil {
+				return err
+			}
+			rows = whoamiClusters(ctx, clusters, kubeexec.AuthUser)
+		case len(args) == 1:
+			c, err := discovery.GetCluster(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			rows = whoamiClusters(ctx, []discovery.Cluster{c}, kubeexec.AuthUser)
+		default:
+			rows = []whoamiRow{whoamiHub(ctx)}
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tUSER\tGROUPS\tAGE\tEXPIRES\tSTATUS")
+		now := time.Now()
+		for _, r := range rows {
+			age := "-"
+			if !r.info.ObtainedAt.IsZero() {
+				age = output.HumanDuration(now.Sub(r.info.ObtainedAt))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.name, orDash(r.info.User), orDash(strings.Join(r.info.Groups, ",")), age, expiresIn(r.info.ExpiresAt, now), r.status)
+		}
+		return tw.Flush()
+	},
+}
+
+// Token states shown by whoami and "tokens ls --check" and used by "tokens refresh".
+const (
+	statusNoToken  = "no token"
+	statusValid    = "valid"
+	statusExpired  = "expired"
+	statusRejected = "rejected"
+)
+
+type whoamiRow struct {
+	name   string
+	info   keystore.TokenInfo
+	status string
+}
+
+// whoamiClusters checks the cached token of every cluster for the credential source auth (see
+// kubeexec.TokenKey), with bounded concurrency.
+func whoamiClusters(ctx context.Context, clusters []discovery.Cluster, auth string) []whoamiRow {
+	rows := make([]whoamiRow, len(clusters))
+	fanout.Each(len(clusters), fanout.DefaultParallel, func(i int) {
+		rows[i] = whoamiCluster(ctx, clusters[i], kubeexec.TokenKey(clusters[i].Name, auth))
+	})
+	return rows
+}
+
+func whoamiCluster(ctx context.Context, c discovery.Cluster, key string) whoamiRow {
+	row := whoamiRow{name: c.Name}
+	if !kubeexec.CanRefreshToken(c) {
+		row.status = "not checked (kubeconfig or MOC_TARGET_TOKEN)"
+		return row
+	}
+	row.info, _, _ = keystore.GetTargetTokenInfo(key)
+	token, _ := keystore.GetTargetToken(key)
+	if token == "" {
+		row.status = statusNoToken
+		return row
+	}
+	if c.APIURL == "" {
+		row.status = "no API URL"
+		return row
+	}
+	info, err := kubeexec.CheckToken(ctx, c, key, token)
+	row.info = info
+	row.status = tokenStatus(info, err)
+	return row
+}
+
+func whoamiHub(ctx context.Context) whoamiRow {
+	row := whoamiRow{name: "(hub)"}
+	client, err := identity.HubClient()
+	if err != nil {
+		if errors.Is(err, identity.ErrNoHubSession) {
+			row.status = statusNoToken
+		} else {
+			row.status = err.Error()
+		}
+		return row
+	}
+	id, err := client.Identity(ctx)
+	if err == nil {
+		row.info = keystore.TokenInfo{User: id.User, Groups: id.Groups, ExpiresAt: id.ExpiresAt}
+	}
+	row.status = tokenStatus(row.info, err)
+	return row
+}
+
+func tokenStatus(info keystore.TokenInfo, err error) string {
+	switch {
+	case kubeapi.IsUnauthorized(err):
+		if info.Expired(time.Now()) {
+			return statusExpired
+		}
+		return statusRejected
+	case kubeapi.IsNetwork(err):
+		return "unreachable"
+	case err != nil:
+		return "unknown (" + err.Error() + ")"
+	case info.Expired(time.Now()):
+		return statusExpired
+	}
+	return statusValid
+}
+
+// expiresIn formats an expiry time relative to now; "-" if unknown or the token does not expire.
+func expiresIn(t, now time.Time) string {
+	switch {
+	case t.IsZero():
+		return "-"
+	case !now.Before(t):
+		return output.HumanDuration(now.Sub(t)) + " ago"
+	}
+	return "in " + output.HumanDuration(t.Sub(now))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	whoamiCmd.Flags().BoolVar(&whoamiAll, "all", false, "Show the token of every discovered cluster")
+	rootCmd.AddCommand(whoamiCmd)
+}
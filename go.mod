@@ -5,6 +5,9 @@ go 1.21
 require (
 	github.com/spf13/cobra v1.8.0
 	github.com/zalando/go-keyring v0.2.5
+	golang.org/x/crypto v0.21.0
+	golang.org/x/term v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -13,5 +16,5 @@ require (
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
 )
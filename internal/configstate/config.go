@@ -3,17 +3,79 @@ package configstate
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	appDirName = "multi-oc"
-	stateFile   = "state.json"
+	stateFile  = "state.json"
 )
 
 type state struct {
-	HubURL string `json:"hubURL"`
+	// CurrentHub is the name of the hub used when no other is selected (MOC_HUB, "hub/cluster").
+	CurrentHub string     `json:"currentHub,omitempty"`
+	Hubs       []hubEntry `json:"hubs,omitempty"`
+	// KeystoreVersion is the layout of stored credentials (see keystore's migration).
+	KeystoreVersion int `json:"keystoreVersion,omitempty"`
+	// HubURL is the single hub of older versions; moved into Hubs as "default" on load.
+	HubURL string `json:"hubURL,omitempty"`
+	// LegacyHubID is the ID given to that hub. The credentials of the original layout belong to
+	// it, whichever hub is active when they are migrated.
+	LegacyHubID string `json:"legacyHubID,omitempty"`
+}
+
+type hubEntry struct {
+	Name string `json:"name"`
+	// ID scopes the stored credentials and caches of the hub and its clusters. It is derived from
+	// the hub URL when the hub is added and kept when the URL changes later.
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Endpoints are further API URLs of the same hub (other load balancers or sites), tried in
+	// order after URL. LastURL is the endpoint that answered last; it is tried first.
+	Endpoints []string `json:"endpoints,omitempty"`
+	LastURL   string   `json:"lastURL,omitempty"`
+	// TLS settings used for direct API calls to the hub (set by "moc login").
+	CAFile   string `json:"caFile,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// Hub is a configured hub and how to verify its TLS certificate.
+type Hub struct {
+	Name string
+	ID   string
+	// URL is the primary API URL; Endpoints are the alternatives in the order they are tried.
+	URL       string
+	Endpoints []string
+	// LastURL is the endpoint that answered last.
+	LastURL  string
+	CAFile   string
+	Insecure bool
+}
+
+// URLs returns all API URLs of the hub in the order they are tried: the endpoint that answered
+// last, then the primary URL and the other endpoints as configured.
+func (h Hub) URLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range append([]string{h.LastURL, h.URL}, h.Endpoints...) {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Server returns the API URL to use first (see URLs).
+func (h Hub) Server() string {
+	if urls := h.URLs(); len(urls) > 0 {
+		return urls[0]
+	}
+	return ""
 }
 
 func configDir() (string, error) {
@@ -28,7 +90,60 @@ func configDir() (string, error) {
 	return filepath.Join(base, appDirName), nil
 }
 
-func SaveHub(hubURL string) error {
+// HubKubeconfigPath returns the moc-owned kubeconfig holding the session of the active hub
+// (~/.config/multi-oc/hub/<hub-id>.kubeconfig). It is passed explicitly to every oc call against the
+// hub, so the user's ~/.kube/config and its current context are never touched.
+func HubKubeconfigPath() (string, error) {
+	h, err := LoadHubConfig()
+	if err != nil {
+		return "", err
+	}
+	if h.ID == "" {
+		return "", errNoHub
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hub", h.ID+".kubeconfig"), nil
+}
+
+func load() (state, error) {
+	dir, err := configDir()
+	if err != nil {
+		return state{}, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state{}, nil
+		}
+		return state{}, err
+	}
+	var st state
+	if err := json.Unmarshal(b, &st); err != nil {
+		return state{}, err
+	}
+	if st.HubURL != "" && len(st.Hubs) == 0 {
+		if err := migrateSingleHub(&st); err != nil {
+			return state{}, err
+		}
+	}
+	return st, nil
+}
+
+// migrateSingleHub turns the single hub of older versions into the hub "default" and records its
+// ID as the owner of the credentials stored before (see LegacyHubID).
+func migrateSingleHub(st *state) error {
+	id := hubIDFromURL(st.HubURL)
+	st.Hubs = []hubEntry{{Name: "default", ID: id, URL: st.HubURL}}
+	st.CurrentHub = "default"
+	st.HubURL = ""
+	st.LegacyHubID = id
+	return save(*st)
+}
+
+func save(st state) error {
 	dir, err := configDir()
 	if err != nil {
 		return err
@@ -36,7 +151,6 @@ func SaveHub(hubURL string) error {
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return err
 	}
-	st := state{HubURL: hubURL}
 	b, err := json.MarshalIndent(st, "", "  ")
 	if err != nil {
 		return err
@@ -44,21 +158,114 @@ func SaveHub(hubURL string) error {
 	return os.WriteFile(filepath.Join(dir, stateFile), b, 0o600)
 }
 
-func LoadHub() (string, error) {
-	dir, err := configDir()
+// SaveHubConfig stores the URL and TLS settings of the active hub, adding it as "default" if no
+// hub is configured yet. A URL that is already one of the hub's endpoints is only recorded as
+// the one that answered last.
+func SaveHubConfig(h Hub) error {
+	st, err := load()
 	if err != nil {
-		return "", err
+		return err
 	}
-	b, err := os.ReadFile(filepath.Join(dir, stateFile))
+	e := st.active()
+	if e == nil {
+		if len(st.Hubs) > 0 {
+			return errNoHub
+		}
+		st.Hubs = append(st.Hubs, hubEntry{Name: "default", ID: st.uniqueID(h.URL, "default")})
+		st.CurrentHub = "default"
+		e = &st.Hubs[0]
+	}
+	if e.has(h.URL) {
+		e.LastURL = h.URL
+	} else {
+		e.URL, e.LastURL = h.URL, ""
+	}
+	e.CAFile = h.CAFile
+	e.Insecure = h.Insecure
+	return save(st)
+}
+
+// LoadHubConfig returns the active hub: the one selected for this run (SetActiveHub, MOC_HUB),
+// else the current hub. URL is empty if no hub is configured.
+func LoadHubConfig() (Hub, error) {
+	st, err := load()
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return "", nil
+		return Hub{}, err
+	}
+	if name := selectedHub(); name != "" && st.find(name) == nil {
+		return Hub{}, fmt.Errorf("unknown hub %q (see 'moc hub ls')", name)
+	}
+	if e := st.active(); e != nil {
+		return e.hub(), nil
+	}
+	return Hub{}, nil
+}
+
+// HubID returns the ID of the active hub; "" if no hub is configured.
+func HubID() (string, error) {
+	h, err := LoadHubConfig()
+	return h.ID, err
+}
+
+// hubIDFromURL derives a hub ID from the API host, e.g. "api.hub.example_6443". It only contains
+// characters that are safe in file names and keyring entries.
+func hubIDFromURL(hubURL string) string {
+	name := hubURL
+	if u, err := url.Parse(hubURL); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
 		}
-		return "", err
+		return '_'
+	}, name)
+}
+
+// KeystoreVersion returns the layout version of the stored credentials (0 for the original one).
+func KeystoreVersion() (int, error) {
+	st, err := load()
+	return st.KeystoreVersion, err
+}
+
+// LegacyHubID returns the ID of the hub migrated from the single hub of older versions; "" if
+// there was none.
+func LegacyHubID() (string, error) {
+	st, err := load()
+	return st.LegacyHubID, err
+}
+
+// SetKeystoreVersion records that the stored credentials have been migrated to layout v.
+func SetKeystoreVersion(v int) error {
+	st, err := load()
+	if err != nil {
+		return err
 	}
-	var st state
-	if err := json.Unmarshal(b, &st); err != nil {
-		return "", err
+	st.KeystoreVersion = v
+	return save(st)
+}
+
+// CredentialBackends returns the global credential backend and the per-cluster entries of
+// config.yaml; empty values mean the default.
+func CredentialBackends() (string, map[string]string, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return "", nil, err
 	}
-	return st.HubURL, nil
+	perCluster := make(map[string]string)
+	for name, s := range cfg.Clusters {
+		if s.CredentialBackend != "" {
+			perCluster[name] = s.CredentialBackend
+		}
+	}
+	return cfg.Defaults.CredentialBackend, perCluster, nil
+}
+
+// SetCredentialBackend sets the credential backend in config.yaml, globally (cluster "") or for
+// one cluster. An empty backend removes the setting.
+func SetCredentialBackend(cluster, backend string) error {
+	return SetConfigValue(cluster, "", "credentialBackend", backend)
 }
@@ -0,0 +1,39 @@
+package configstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateSingleHub(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("MOC_HUB", "")
+	path := filepath.Join(dir, appDirName, stateFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"hubURL": "https://api.hub.example:6443"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHubConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "default" || h.ID != "api.hub.example_6443" || h.URL != "https://api.hub.example:6443" {
+		t.Errorf("unexpected hub %+v", h)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := LegacyHubID(); err != nil || id != h.ID {
+		t.Errorf("LegacyHubID = %q, %v; want %q", id, err, h.ID)
+	}
+	if strings.Contains(string(b), "hubURL") || !strings.Contains(string(b), `"currentHub": "default"`) {
+		t.Errorf("state.json not migrated: %s", b)
+	}
+}
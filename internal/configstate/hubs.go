@@ -0,0 +1,285 @@
+package configstate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// errNoHub is returned when a hub is needed but none is configured.
+var errNoHub = errors.New("no hub configured; run 'moc login --hub <url>'")
+
+// hubNameRE restricts hub names so that they never contain "/" (used in "hub/cluster").
+var hubNameRE = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+func (e hubEntry) hub() Hub {
+	return Hub{Name: e.Name, ID: e.ID, URL: e.URL, Endpoints: e.Endpoints, LastURL: e.LastURL, CAFile: e.CAFile, Insecure: e.Insecure}
+}
+
+// has reports whether u is one of the hub's API URLs.
+func (e hubEntry) has(u string) bool {
+	u = strings.TrimRight(u, "/")
+	for _, v := range append([]string{e.URL}, e.Endpoints...) {
+		if strings.TrimRight(v, "/") == u {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitURLs splits a comma-separated list of hub API URLs ("https://vip:6443,https://lb2:6443").
+func SplitURLs(value string) []string {
+	var urls []string
+	for _, u := range strings.Split(value, ",") {
+		if u = strings.TrimPrefix(strings.TrimSpace(u), "@"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func (st *state) find(name string) *hubEntry {
+	for i := range st.Hubs {
+		if st.Hubs[i].Name == name {
+			return &st.Hubs[i]
+		}
+	}
+	return nil
+}
+
+// runHub is the hub selected for this run with SetActiveHub; it wins over MOC_HUB.
+var runHub struct {
+	sync.Mutex
+	name string
+}
+
+// SetActiveHub selects the hub used for the rest of the run (--hub, "hub/cluster") without
+// changing the current hub, and returns the previous selection. "" goes back to MOC_HUB or the
+// current hub. The name is checked by the next LoadHubConfig.
+func SetActiveHub(name string) string {
+	runHub.Lock()
+	defer runHub.Unlock()
+	prev := runHub.name
+	runHub.name = strings.TrimSpace(name)
+	return prev
+}
+
+// selectedHub returns the hub selected for this run, else MOC_HUB; "" means the current hub.
+func selectedHub() string {
+	runHub.Lock()
+	defer runHub.Unlock()
+	if runHub.name != "" {
+		return runHub.name
+	}
+	return os.Getenv("MOC_HUB")
+}
+
+// HubSelected reports whether this run uses an explicitly selected hub (SetActiveHub or MOC_HUB)
+// rather than the current one.
+func HubSelected() bool {
+	return selectedHub() != ""
+}
+
+// active returns the hub selected for this run, else the current hub; nil if there is none.
+func (st *state) active() *hubEntry {
+	if name := selectedHub(); name != "" {
+		return st.find(name)
+	}
+	if e := st.find(st.CurrentHub); e != nil {
+		return e
+	}
+	if len(st.Hubs) == 1 {
+		return &st.Hubs[0]
+	}
+	return nil
+}
+
+// uniqueID derives the ID of a new hub from its URL; if another hub already uses that ID (same
+// host), the hub name is appended so that their credentials stay apart.
+func (st *state) uniqueID(hubURL, name string) string {
+	id := hubIDFromURL(hubURL)
+	for _, e := range st.Hubs {
+		if e.ID == id {
+			return id + "_" + strings.ToLower(name)
+		}
+	}
+	return id
+}
+
+// ValidateHubName rejects hub names that cannot be used in "hub/cluster" target names.
+func ValidateHubName(name string) error {
+	if len(name) > 63 || !hubNameRE.MatchString(name) {
+		return fmt.Errorf("invalid hub name %q (letters, digits, '-', '_' and '.')", name)
+	}
+	return nil
+}
+
+// ListHubs returns the configured hubs and the name of the current one.
+func ListHubs() ([]Hub, string, error) {
+	st, err := load()
+	if err != nil {
+		return nil, "", err
+	}
+	hubs := make([]Hub, 0, len(st.Hubs))
+	for _, e := range st.Hubs {
+		hubs = append(hubs, e.hub())
+	}
+	current := ""
+	if e := st.find(st.CurrentHub); e != nil {
+		current = e.Name
+	} else if len(st.Hubs) == 1 {
+		current = st.Hubs[0].Name
+	}
+	return hubs, current, nil
+}
+
+// AddHub adds a hub under a new name, with h.URL and h.Endpoints as its API URLs. The first hub
+// becomes the current one.
+func AddHub(h Hub) error {
+	if err := ValidateHubName(h.Name); err != nil {
+		return err
+	}
+	if h.URL == "" {
+		return fmt.Errorf("hub API URL is required")
+	}
+	st, err := load()
+	if err != nil {
+		return err
+	}
+	if st.find(h.Name) != nil {
+		return fmt.Errorf("hub %q already exists", h.Name)
+	}
+	st.Hubs = append(st.Hubs, hubEntry{Name: h.Name, ID: st.uniqueID(h.URL, h.Name), URL: h.URL, Endpoints: h.Endpoints, CAFile: h.CAFile, Insecure: h.Insecure})
+	if len(st.Hubs) == 1 {
+		st.CurrentHub = h.Name
+	}
+	return save(st)
+}
+
+// UseHub makes a hub the current one.
+func UseHub(name string) error {
+	st, err := load()
+	if err != nil {
+		return err
+	}
+	if st.find(name) == nil {
+		return fmt.Errorf("unknown hub %q (see 'moc hub ls')", name)
+	}
+	st.CurrentHub = name
+	return save(st)
+}
+
+// SetHubURLs replaces the API URLs of a hub; the first one becomes the primary URL. The hub keeps
+// its ID, so its session and tokens stay valid.
+func SetHubURLs(name string, urls []string) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("hub API URL is required")
+	}
+	st, err := load()
+	if err != nil {
+		return err
+	}
+	e := st.find(name)
+	if e == nil {
+		return fmt.Errorf("unknown hub %q (see 'moc hub ls')", name)
+	}
+	e.URL, e.Endpoints = urls[0], urls[1:]
+	if !e.has(e.LastURL) {
+		e.LastURL = ""
+	}
+	return save(st)
+}
+
+// RecordHubEndpoint remembers the endpoint of the active hub that answered last, so that the
+// next run tries it first.
+func RecordHubEndpoint(u string) error {
+	st, err := load()
+	if err != nil {
+		return err
+	}
+	e := st.active()
+	if e == nil || !e.has(u) || e.LastURL == u {
+		return nil
+	}
+	e.LastURL = u
+	return save(st)
+}
+
+// RemoveHub forgets a hub. Its credentials must have been removed before (see "moc hub rm").
+func RemoveHub(name string) error {
+	st, err := load()
+	if err != nil {
+		return err
+	}
+	for i, e := range st.Hubs {
+		if e.Name != name {
+			continue
+		}
+		st.Hubs = append(st.Hubs[:i], st.Hubs[i+1:]...)
+		if st.CurrentHub == name {
+			st.CurrentHub = ""
+			if len(st.Hubs) > 0 {
+				st.CurrentHub = st.Hubs[0].Name
+			}
+		}
+		return save(st)
+	}
+	return fmt.Errorf("unknown hub %q (see 'moc hub ls')", name)
+}
+
+// SelectHub makes the hub given to "moc login --hub" the current one and returns its name. The
+// value is a hub name or API URLs (comma-separated for several endpoints). URLs no hub uses yet
+// are added as a new hub, named "default" if it is the first one and after the host otherwise;
+// several URLs given for a known hub replace its endpoints.
+func SelectHub(value string) (string, error) {
+	st, err := load()
+	if err != nil {
+		return "", err
+	}
+	urls := SplitURLs(value)
+	if len(urls) == 0 {
+		return "", fmt.Errorf("hub API URL is required")
+	}
+	e := st.find(value)
+	if e == nil {
+		for i := range st.Hubs {
+			if st.Hubs[i].has(urls[0]) {
+				e = &st.Hubs[i]
+				break
+			}
+		}
+		if e != nil && len(urls) > 1 {
+			e.URL, e.Endpoints = urls[0], urls[1:]
+		}
+	}
+	if e == nil {
+		if !strings.Contains(urls[0], "://") {
+			return "", fmt.Errorf("unknown hub %q; give an API URL (https://api.hub:6443) or see 'moc hub ls'", value)
+		}
+		name := "default"
+		if len(st.Hubs) > 0 {
+			name = hubNameFromURL(urls[0])
+			for n := 2; st.find(name) != nil; n++ {
+				name = fmt.Sprintf("%s-%d", hubNameFromURL(urls[0]), n)
+			}
+		}
+		st.Hubs = append(st.Hubs, hubEntry{Name: name, ID: st.uniqueID(urls[0], name), URL: urls[0], Endpoints: urls[1:]})
+		e = &st.Hubs[len(st.Hubs)-1]
+	}
+	st.CurrentHub = e.Name
+	return e.Name, save(st)
+}
+
+// hubNameFromURL proposes a hub name from the API host: "api.hub1.example.com:6443" → "hub1".
+func hubNameFromURL(hubURL string) string {
+	host := strings.Split(hubIDFromURL(hubURL), "_")[0]
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "api-int."), "api.")
+	name, _, _ := strings.Cut(host, ".")
+	if ValidateHubName(name) != nil {
+		return "hub"
+	}
+	return name
+}
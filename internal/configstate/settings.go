@@ -0,0 +1,444 @@
+package configstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"multi-oc/internal/labels"
+)
+
+// configFile holds the user's settings (~/.config/multi-oc/config.yaml). Unlike state.json it is
+// meant to be edited by hand; "moc config set" keeps comments and layout.
+const configFile = "config.yaml"
+
+// SettingKeys lists the keys of Settings as written in config.yaml.
+var SettingKeys = []string{"caFile", "insecure", "proxy", "namespace", "requestTimeout", "apiURL", "credentialBackend"}
+
+// Settings are the per-cluster knobs of config.yaml. Empty fields are not set.
+type Settings struct {
+	// CAFile verifies the cluster's API server instead of the CA bundle from the hub.
+	CAFile string `yaml:"caFile,omitempty"`
+	// Insecure skips TLS verification.
+	Insecure *bool `yaml:"insecure,omitempty"`
+	// Proxy is the HTTP(S) proxy URL used for the cluster API.
+	Proxy string `yaml:"proxy,omitempty"`
+	// Namespace is the default namespace of oc commands.
+	Namespace string `yaml:"namespace,omitempty"`
+	// RequestTimeout is passed to oc as --request-timeout (e.g. "30s", "2m").
+	RequestTimeout string `yaml:"requestTimeout,omitempty"`
+	// APIURL is the API URL to use among the cluster's managedClusterClientConfigs.
+	APIURL string `yaml:"apiURL,omitempty"`
+	// CredentialBackend stores the cluster's token (see BackendNames).
+	CredentialBackend string `yaml:"credentialBackend,omitempty"`
+}
+
+// BackendNames lists the selectable credential backends (see keystore.ParseBackend). "helper"
+// may carry its command as "helper:<command>".
+var BackendNames = []string{"auto", "keyring", "file", "encrypted", "pass", "vault", "helper"}
+
+// Rule applies settings to every cluster whose labels match Selector.
+type Rule struct {
+	Selector string `yaml:"selector"`
+	Settings `yaml:",inline"`
+}
+
+// Config is the content of config.yaml:
+//
+//	defaults:
+//	  requestTimeout: 1m
+//	match:
+//	  - selector: env=prod
+//	    proxy: http://proxy.prod:3128
+//	clusters:
+//	  lab-1:
+//	    insecure: true
+//	  hub2/edge-3:
+//	    apiURL: https://api.edge-3.internal:6443
+type Config struct {
+	Defaults Settings            `yaml:"defaults,omitempty"`
+	Match    []Rule              `yaml:"match,omitempty"`
+	Clusters map[string]Settings `yaml:"clusters,omitempty"`
+}
+
+// configCache is the parsed config.yaml at configCachePath.
+var (
+	configMu        sync.Mutex
+	configCache     *Config
+	configCachePath string
+)
+
+// ConfigPath returns the path of config.yaml.
+func ConfigPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFile), nil
+}
+
+// LoadConfig parses config.yaml; a missing file is an empty configuration. Unknown keys, invalid
+// selectors and invalid values are errors, so that typos do not go unnoticed.
+func LoadConfig() (Config, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return Config{}, err
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	if configCache != nil && configCachePath == path {
+		return *configCache, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, err
+	}
+	cfg, err := parseConfig(b)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	configCache, configCachePath = &cfg, path
+	return cfg, nil
+}
+
+// parseConfig decodes and validates the content of config.yaml.
+func parseConfig(b []byte) (Config, error) {
+	var cfg Config
+	if len(bytes.TrimSpace(b)) == 0 {
+		return cfg, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (c Config) validate() error {
+	check := func(where string, s Settings) error {
+		for _, key := range SettingKeys {
+			value, _ := s.Get(key)
+			if err := CheckSetting(key, value); err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+		}
+		return nil
+	}
+	if err := check("defaults", c.Defaults); err != nil {
+		return err
+	}
+	for i, r := range c.Match {
+		if _, err := labels.Parse(r.Selector); err != nil || strings.TrimSpace(r.Selector) == "" {
+			return fmt.Errorf("match[%d]: invalid selector %q", i, r.Selector)
+		}
+		if err := check(fmt.Sprintf("match[%d]", i), r.Settings); err != nil {
+			return err
+		}
+	}
+	for name, s := range c.Clusters {
+		if err := check("clusters."+name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClusterSettings returns the settings of a cluster: the defaults, overridden by every matching
+// rule in file order, then by the cluster's own entry ("<cluster>", then "<hub>/<cluster>").
+// lbls are the cluster's labels, matched against the rules' selectors. Environment variables are
+// applied by the callers and win over all of these.
+func ClusterSettings(clusterName string, lbls map[string]string) (Settings, error) {
+	hub, err := LoadHubConfig()
+	if err != nil {
+		return Settings{}, err
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return Settings{}, err
+	}
+	s := cfg.Defaults
+	if clusterName == "" {
+		return s, nil
+	}
+	for _, r := range cfg.Match {
+		if sel, err := labels.Parse(r.Selector); err == nil && sel.Matches(lbls) {
+			s = s.Merge(r.Settings)
+		}
+	}
+	s = s.Merge(cfg.Clusters[clusterName])
+	if hub.Name != "" {
+		s = s.Merge(cfg.Clusters[hub.Name+"/"+clusterName])
+	}
+	return s, nil
+}
+
+// Merge returns s with every field set in o overriding it.
+func (s Settings) Merge(o Settings) Settings {
+	if o.CAFile != "" {
+		s.CAFile = o.CAFile
+	}
+	if o.Insecure != nil {
+		s.Insecure = o.Insecure
+	}
+	if o.Proxy != "" {
+		s.Proxy = o.Proxy
+	}
+	if o.Namespace != "" {
+		s.Namespace = o.Namespace
+	}
+	if o.RequestTimeout != "" {
+		s.RequestTimeout = o.RequestTimeout
+	}
+	if o.APIURL != "" {
+		s.APIURL = o.APIURL
+	}
+	if o.CredentialBackend != "" {
+		s.CredentialBackend = o.CredentialBackend
+	}
+	return s
+}
+
+// Get returns the value of key as written in config.yaml ("" if not set).
+func (s Settings) Get(key string) (string, error) {
+	switch key {
+	case "caFile":
+		return s.CAFile, nil
+	case "insecure":
+		if s.Insecure == nil {
+			return "", nil
+		}
+		return strconv.FormatBool(*s.Insecure), nil
+	case "proxy":
+		return s.Proxy, nil
+	case "namespace":
+		return s.Namespace, nil
+	case "requestTimeout":
+		return s.RequestTimeout, nil
+	case "apiURL":
+		return s.APIURL, nil
+	case "credentialBackend":
+		return s.CredentialBackend, nil
+	}
+	return "", unknownKey(key)
+}
+
+// CheckSetting reports whether value is valid for key; "" (not set) always is. The same checks
+// apply to "moc config set" and to a hand-edited config.yaml. That a caFile exists is checked by
+// SetConfigValue and when the cluster is used, so that a missing file only affects its clusters.
+func CheckSetting(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch key {
+	case "insecure":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("insecure expects true or false, got %q", value)
+		}
+	case "requestTimeout":
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid requestTimeout %q (e.g. 30s, 2m)", value)
+		}
+	case "proxy", "apiURL":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s expects a URL (https://host:port), got %q", key, value)
+		}
+	case "credentialBackend":
+		name, _, _ := strings.Cut(value, ":")
+		if !slices.Contains(BackendNames, strings.ToLower(strings.TrimSpace(name))) {
+			return fmt.Errorf("unknown credential backend %q (expected one of %s)", value, strings.Join(BackendNames, ", "))
+		}
+	}
+	return nil
+}
+
+func unknownKey(key string) error {
+	return fmt.Errorf("unknown setting %q (expected one of %s)", key, strings.Join(SettingKeys, ", "))
+}
+
+// SetConfigValue sets key in the defaults (cluster and selector ""), a cluster's entry or the
+// rule for selector, creating them as needed. An empty value removes the key, and entries left
+// empty are removed as well. Comments and the order of the file are kept. The edited file is
+// validated as a whole before it is written, so an invalid result leaves the file unchanged.
+func SetConfigValue(cluster, selector, key, value string) error {
+	if _, err := (Settings{}).Get(key); err != nil {
+		return err
+	}
+	if err := CheckSetting(key, value); err != nil {
+		return err
+	}
+	if key == "caFile" && value != "" {
+		if _, err := os.Stat(value); err != nil {
+			return fmt.Errorf("caFile: %w", err)
+		}
+	}
+	if selector != "" {
+		if _, err := labels.Parse(selector); err != nil {
+			return err
+		}
+	}
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		// The file is empty or holds nothing but comments.
+		doc = yaml.Node{Kind: yaml.DocumentNode, HeadComment: strings.TrimSpace(string(b)), Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+	// The comments at the top of the file belong to the first key; they stay at the top if that
+	// key is removed.
+	var first *yaml.Node
+	if len(root.Content) > 0 {
+		first = root.Content[0]
+	}
+
+	create := value != ""
+	var target *yaml.Node
+	switch {
+	case selector != "":
+		match := mappingValue(root, "match", yaml.SequenceNode, create)
+		if match != nil {
+			for _, item := range match.Content {
+				if sel := mappingValue(item, "selector", yaml.ScalarNode, false); sel != nil && sel.Value == selector {
+					target = item
+				}
+			}
+			if target == nil && create {
+				target = &yaml.Node{Kind: yaml.MappingNode}
+				setScalar(target, "selector", selector, "")
+				match.Content = append(match.Content, target)
+			}
+		}
+	case cluster != "":
+		if clusters := mappingValue(root, "clusters", yaml.MappingNode, create); clusters != nil {
+			target = mappingValue(clusters, cluster, yaml.MappingNode, create)
+		}
+	default:
+		target = mappingValue(root, "defaults", yaml.MappingNode, create)
+	}
+	if target == nil {
+		return nil
+	}
+	if value == "" {
+		deleteKey(target, key)
+	} else {
+		tag := ""
+		if key == "insecure" {
+			tag = "!!bool"
+		}
+		setScalar(target, key, value, tag)
+	}
+	pruneEmpty(root)
+	if first != nil && first.HeadComment != "" && (len(root.Content) == 0 || root.Content[0] != first) {
+		doc.HeadComment = strings.TrimSpace(doc.HeadComment + "\n\n" + first.HeadComment)
+	}
+
+	var out bytes.Buffer
+	if len(root.Content) > 0 {
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+	} else if doc.HeadComment != "" {
+		out.WriteString(doc.HeadComment + "\n")
+	}
+	if _, err := parseConfig(out.Bytes()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		return err
+	}
+	configMu.Lock()
+	configCache = nil
+	configMu.Unlock()
+	return nil
+}
+
+// mappingValue returns the value of key in mapping m, adding it with the given kind if create is set.
+func mappingValue(m *yaml.Node, key string, kind yaml.Kind, create bool) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	if !create {
+		return nil
+	}
+	v := &yaml.Node{Kind: kind}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v
+}
+
+func setScalar(m *yaml.Node, key, value, tag string) {
+	v := mappingValue(m, key, yaml.ScalarNode, true)
+	v.Kind, v.Value, v.Tag, v.Style = yaml.ScalarNode, value, tag, 0
+}
+
+func deleteKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// pruneEmpty removes cluster entries and rules without settings, and sections left empty.
+func pruneEmpty(root *yaml.Node) {
+	if clusters := mappingValue(root, "clusters", yaml.MappingNode, false); clusters != nil {
+		for i := 0; i+1 < len(clusters.Content); {
+			if len(clusters.Content[i+1].Content) == 0 {
+				clusters.Content = append(clusters.Content[:i], clusters.Content[i+2:]...)
+				continue
+			}
+			i += 2
+		}
+	}
+	if match := mappingValue(root, "match", yaml.SequenceNode, false); match != nil {
+		kept := match.Content[:0]
+		for _, item := range match.Content {
+			if len(item.Content) > 2 || mappingValue(item, "selector", yaml.ScalarNode, false) == nil {
+				kept = append(kept, item)
+			}
+		}
+		match.Content = kept
+	}
+	for i := 0; i+1 < len(root.Content); {
+		v := root.Content[i+1]
+		if (v.Kind == yaml.MappingNode || v.Kind == yaml.SequenceNode) && len(v.Content) == 0 {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			continue
+		}
+		i += 2
+	}
+}
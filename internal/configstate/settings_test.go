@@ -0,0 +1,121 @@
+package configstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes config.yaml into a temporary configuration directory.
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, appDirName), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, appDirName, configFile), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(ca, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, `defaults:
+  requestTimeout: 1m
+  credentialBackend: helper:my-helper
+match:
+  - selector: env=prod
+    proxy: http://proxy.prod:3128
+clusters:
+  lab-1:
+    caFile: `+ca+`
+    apiURL: https://api.lab-1.internal:6443
+`)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Defaults.RequestTimeout != "1m" || cfg.Match[0].Proxy != "http://proxy.prod:3128" || cfg.Clusters["lab-1"].CAFile != ca {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := map[string]string{
+		"requestTimeout":    "defaults:\n  requestTimeout: soon\n",
+		"proxy":             "match:\n  - selector: env=prod\n    proxy: proxy.prod\n",
+		"apiURL":            "clusters:\n  c1:\n    apiURL: api.c1:6443\n",
+		"credentialBackend": "defaults:\n  credentialBackend: keychain\n",
+		"selector":          "match:\n  - selector: 'env in (prod'\n    insecure: true\n",
+		"unknown key":       "defaults:\n  timeout: 1m\n",
+	}
+	for name, content := range tests {
+		writeConfig(t, content)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if name == "apiURL" && !strings.Contains(err.Error(), "clusters.c1") {
+			t.Errorf("%s: error does not say where: %v", name, err)
+		}
+	}
+}
+
+func TestMissingCAFile(t *testing.T) {
+	writeConfig(t, "clusters:\n  c1:\n    caFile: /does/not/exist.crt\n")
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("a missing CA file must only fail its cluster: %v", err)
+	}
+	if err := SetConfigValue("c2", "", "caFile", "/does/not/exist.crt"); err == nil {
+		t.Error("config set: expected an error for a missing CA file")
+	}
+}
+
+func TestSetConfigValueKeepsComments(t *testing.T) {
+	read := func() string {
+		t.Helper()
+		path, _ := ConfigPath()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	writeConfig(t, "# settings for the lab\n# see README\n")
+	if err := SetConfigValue("", "", "requestTimeout", "1m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); !strings.HasPrefix(got, "# settings for the lab\n# see README\n") || !strings.Contains(got, "requestTimeout: 1m") {
+		t.Errorf("comments of a comment-only file lost:\n%s", got)
+	}
+	if err := SetConfigValue("", "", "requestTimeout", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "# settings for the lab\n# see README\n" {
+		t.Errorf("removing the only key must keep the comments, got:\n%s", got)
+	}
+
+	writeConfig(t, "# head\ndefaults:\n  proxy: http://proxy:3128\nclusters:\n  c1:\n    namespace: lab\n")
+	if err := SetConfigValue("", "", "proxy", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); !strings.HasPrefix(got, "# head\n") || strings.Contains(got, "defaults") {
+		t.Errorf("the comment at the top must stay when the first key is removed, got:\n%s", got)
+	}
+}
+
+func TestSetConfigValueInvalidNotWritten(t *testing.T) {
+	const content = "defaults:\n  timeout: 1m\n"
+	writeConfig(t, content)
+	if err := SetConfigValue("c1", "", "namespace", "lab"); err == nil {
+		t.Error("expected an error for the invalid file")
+	}
+	path, _ := ConfigPath()
+	if b, _ := os.ReadFile(path); string(b) != content {
+		t.Errorf("file changed although the result is invalid:\n%s", b)
+	}
+}
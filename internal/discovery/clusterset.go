@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/labels"
+)
+
+// ClusterSetLabel is the label ACM uses to assign a ManagedCluster to an exclusive ManagedClusterSet.
+const ClusterSetLabel = "cluster.open-cluster-management.io/clusterset"
+
+type managedClusterSet struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		ClusterSelector struct {
+			SelectorType  string                `json:"selectorType"`
+			LabelSelector *labels.LabelSelector `json:"labelSelector"`
+		} `json:"clusterSelector"`
+	} `json:"spec"`
+}
+
+// resolveClusterSets fills Cluster.ClusterSets and returns the sorted names of all known sets.
+// ManagedClusterSets are read from the hub to evaluate LabelSelector-type sets (e.g. "global").
+// If the hub serves no ManagedClusterSet API, membership is derived from the clusterset label
+// alone; if the sets cannot be read for another reason (e.g. not permitted), the same is done
+// with a warning, since LabelSelector-type sets are then missing.
+func resolveClusterSets(ctx context.Context, clusters []Cluster) ([]string, error) {
+	var sets []managedClusterSet
+	// v1beta2 since ACM 2.7, v1beta1 before
+	for _, version := range []string{"v1beta2", "v1beta1"} {
+		raw, err := listOnHub(ctx, "/apis/cluster.open-cluster-management.io/"+version+"/managedclustersets", nil)
+		if err == nil {
+			if err := kubeapi.DecodeItems(raw, &sets); err != nil {
+				return nil, fmt.Errorf("decoding ManagedClusterSets: %w", err)
+			}
+			break
+		}
+		if !kubeapi.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Warning: cannot read ManagedClusterSets, cluster sets are taken from the %s label only: %v\n", ClusterSetLabel, err)
+			break
+		}
+	}
+
+	all := make(map[string]bool)
+	for _, set := range sets {
+		all[set.Metadata.Name] = true
+	}
+	for i := range clusters {
+		c := &clusters[i]
+		member := make(map[string]bool)
+		if name := c.Labels[ClusterSetLabel]; name != "" {
+			member[name] = true
+		}
+		for _, set := range sets {
+			if set.Spec.ClusterSelector.SelectorType != "LabelSelector" {
+				continue
+			}
+			var ls labels.LabelSelector
+			if set.Spec.ClusterSelector.LabelSelector != nil {
+				ls = *set.Spec.ClusterSelector.LabelSelector
+			}
+			sel, err := ls.Selector()
+			if err != nil {
+				continue
+			}
+			if sel.Matches(c.Labels) {
+				member[set.Metadata.Name] = true
+			}
+		}
+		c.ClusterSets = sortedKeys(member)
+		for name := range member {
+			all[name] = true
+		}
+	}
+	return sortedKeys(all), nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
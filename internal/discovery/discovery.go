@@ -6,27 +6,46 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"multi-oc/internal/configstate"
 	"multi-oc/internal/identity"
+	"multi-oc/internal/kubeapi"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"time"
 )
 
 type Cluster struct {
-	Name   string `json:"name"`
+	Name string `json:"name"`
+	// APIURL and CAData are the endpoint in use: the one remembered as working, else the first
+	// of Endpoints (see kubeexec.SelectEndpoint).
 	APIURL string `json:"apiURL"`
 	CAData []byte `json:"caData"`
+	// Endpoints are all managedClusterClientConfigs of the cluster, in the hub's order.
+	Endpoints []Endpoint        `json:"endpoints,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// ClusterSets lists the ManagedClusterSets the cluster belongs to.
+	ClusterSets []string `json:"clusterSets,omitempty"`
+	Status      Status   `json:"status"`
 }
 
-type managedClusterList struct {
-	Items []managedCluster `json:"items"`
+// Endpoint is one API URL of a cluster with its CA bundle.
+type Endpoint struct {
+	URL    string `json:"url"`
+	CAData []byte `json:"caData,omitempty"`
+}
+
+// WithEndpoint returns c with e as the endpoint in use.
+func (c Cluster) WithEndpoint(e Endpoint) Cluster {
+	c.APIURL, c.CAData = e.URL, e.CAData
+	return c
 }
 
 type managedCluster struct {
 	Metadata struct {
-		Name string `json:"name"`
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
 	} `json:"metadata"`
 	Spec struct {
 		ManagedClusterClientConfigs []struct {
@@ -34,11 +53,19 @@ type managedCluster struct {
 			CABundle string `json:"caBundle"`
 		} `json:"managedClusterClientConfigs"`
 	} `json:"spec"`
+	Status struct {
+		Conditions []condition `json:"conditions"`
+	} `json:"status"`
 }
 
+// cacheVersion is bumped whenever Cluster gains fields, so that older caches are refreshed.
+const cacheVersion = 5
+
 type cacheFile struct {
+	Version     int       `json:"version"`
 	GeneratedAt time.Time `json:"generatedAt"`
 	Items       []Cluster `json:"items"`
+	ClusterSets []string  `json:"clusterSets,omitempty"`
 }
 
 func configDir() (string, error) {
@@ -53,18 +80,38 @@ func configDir() (string, error) {
 	return filepath.Join(base, "multi-oc"), nil
 }
 
+// cachePath returns the discovery cache of the active hub: cache/<hub-id>/managedclusters.json.
 func cachePath() (string, error) {
 	dir, err := configDir()
 	if err != nil {
 		return "", err
 	}
-	cdir := filepath.Join(dir, "cache")
+	id, err := configstate.HubID()
+	if err != nil {
+		return "", err
+	}
+	cdir := filepath.Join(dir, "cache", id)
 	if err := os.MkdirAll(cdir, 0o700); err != nil {
 		return "", err
 	}
 	return filepath.Join(cdir, "managedclusters.json"), nil
 }
 
+// ClearCache removes the cached cluster list so the next call reads the hub again, together with
+// the remembered endpoints.
+func ClearCache() error {
+	cp, err := cachePath()
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{cp, filepath.Join(filepath.Dir(cp), endpointsFile)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
 func ttl() time.Duration {
 	v := os.Getenv("MOC_DISCOVERY_TTL_SECONDS")
 	if v == "" {
@@ -78,70 +125,150 @@ func ttl() time.Duration {
 }
 
 func ListManagedClusters(ctx context.Context) ([]Cluster, error) {
-	// 1) Cache versuchen
-	cp, err := cachePath()
-	if err == nil {
-		if b, err := os.ReadFile(cp); err == nil && len(b) > 0 {
-			var cf cacheFile
-			if json.Unmarshal(b, &cf) == nil {
-				if time.Since(cf.GeneratedAt) <= ttl() {
-					return cf.Items, nil
-				}
-			}
-		}
+	cf, err := load(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return cf.Items, nil
+}
 
-	// 2) Live vom Hub via oc
-	cmd := exec.CommandContext(ctx, "oc", "get", "managedclusters.cluster.open-cluster-management.io", "-o", "json")
-	out, err := cmd.Output()
+// ListClusterSets returns the names of all ManagedClusterSets known from discovery.
+func ListClusterSets(ctx context.Context) ([]string, error) {
+	cf, err := load(ctx)
 	if err != nil {
-		// First attempt failed → ensure login and retry once
-		if loginErr := identity.EnsureHubLogin(ctx); loginErr != nil {
-			var ee *exec.ExitError
-			if errors.As(err, &ee) {
-				return nil, fmt.Errorf("Hub connection required (login failed): %w", loginErr)
-			}
-			return nil, fmt.Errorf("Hub connection required (oc not executable?): %w", loginErr)
-		}
-		// Retry
-		cmd2 := exec.CommandContext(ctx, "oc", "get", "managedclusters.cluster.open-cluster-management.io", "-o", "json")
-		out2, err2 := cmd2.Output()
-		if err2 != nil {
-			return nil, fmt.Errorf("oc get managedclusters after login failed: %w", err2)
-		}
-		out = out2
+		return nil, err
+	}
+	return cf.ClusterSets, nil
+}
+
+// CachedClusters returns the clusters from the discovery cache regardless of its age, without
+// contacting the hub. It returns nil if there is no usable cache.
+func CachedClusters() []Cluster {
+	if cf, ok := readCache(); ok {
+		return withRememberedEndpoints(cf.Items)
+	}
+	return nil
+}
+
+func readCache() (cacheFile, bool) {
+	cp, err := cachePath()
+	if err != nil {
+		return cacheFile{}, false
+	}
+	b, err := os.ReadFile(cp)
+	if err != nil || len(b) == 0 {
+		return cacheFile{}, false
 	}
-	var mcl managedClusterList
-	if err := json.Unmarshal(out, &mcl); err != nil {
+	var cf cacheFile
+	if json.Unmarshal(b, &cf) != nil || cf.Version != cacheVersion {
+		return cacheFile{}, false
+	}
+	return cf, true
+}
+
+func load(ctx context.Context) (cacheFile, error) {
+	// 1) Cache versuchen
+	if cf, ok := readCache(); ok && time.Since(cf.GeneratedAt) <= ttl() {
+		cf.Items = withRememberedEndpoints(cf.Items)
+		return cf, nil
+	}
+	return fetch(ctx)
+}
+
+// RefreshManagedClusters reads the clusters from the hub regardless of the cache's age and
+// updates the cache.
+func RefreshManagedClusters(ctx context.Context) ([]Cluster, error) {
+	cf, err := fetch(ctx)
+	if err != nil {
 		return nil, err
 	}
-	result := make([]Cluster, 0, len(mcl.Items))
-	for _, it := range mcl.Items {
-		var api string
-		var caBytes []byte
-		if len(it.Spec.ManagedClusterClientConfigs) > 0 {
-			api = it.Spec.ManagedClusterClientConfigs[0].URL
-			ca := it.Spec.ManagedClusterClientConfigs[0].CABundle
-			if ca != "" {
-				if decoded, decErr := base64.StdEncoding.DecodeString(ca); decErr == nil {
+	return cf.Items, nil
+}
+
+// fetch reads the clusters and ClusterSets from the hub and writes the cache.
+func fetch(ctx context.Context) (cacheFile, error) {
+	// 2) Live vom Hub via API
+	raw, err := hubList(ctx, "/apis/cluster.open-cluster-management.io/v1/managedclusters", nil)
+	if err != nil {
+		return cacheFile{}, err
+	}
+	var items []managedCluster
+	if err := kubeapi.DecodeItems(raw, &items); err != nil {
+		return cacheFile{}, err
+	}
+	result := make([]Cluster, 0, len(items))
+	for _, it := range items {
+		var endpoints []Endpoint
+		for _, cc := range it.Spec.ManagedClusterClientConfigs {
+			if cc.URL == "" {
+				continue
+			}
+			var caBytes []byte
+			if cc.CABundle != "" {
+				if decoded, decErr := base64.StdEncoding.DecodeString(cc.CABundle); decErr == nil {
 					caBytes = decoded
 				} else {
-					caBytes = []byte(ca)
+					caBytes = []byte(cc.CABundle)
 				}
 			}
+			endpoints = append(endpoints, Endpoint{URL: cc.URL, CAData: caBytes})
 		}
-		result = append(result, Cluster{
-			Name:   it.Metadata.Name,
-			APIURL: api,
-			CAData: caBytes,
-		})
+		c := Cluster{
+			Name:      it.Metadata.Name,
+			Endpoints: endpoints,
+			Labels:    it.Metadata.Labels,
+			Status:    parseStatus(it.Status.Conditions),
+		}
+		if len(endpoints) > 0 {
+			c = c.WithEndpoint(endpoints[0])
+		}
+		result = append(result, c)
+	}
+	cf := cacheFile{Version: cacheVersion, GeneratedAt: time.Now(), Items: result}
+	if cf.ClusterSets, err = resolveClusterSets(ctx, cf.Items); err != nil {
+		return cacheFile{}, err
 	}
 
 	// 3) Cache schreiben (best effort)
 	if cp, err := cachePath(); err == nil {
-		_ = os.WriteFile(cp, mustJSON(cacheFile{GeneratedAt: time.Now(), Items: result}), 0o600)
+		_ = os.WriteFile(cp, mustJSON(cf), 0o600)
 	}
-	return result, nil
+	cf.Items = withRememberedEndpoints(cf.Items)
+	return cf, nil
+}
+
+// hubList lists a collection on the hub via the API. If the hub endpoint in use is unreachable, it
+// fails over to another endpoint of the hub. If there is no hub session yet or the stored token is
+// rejected, it runs the hub login once and retries.
+func hubList(ctx context.Context, path string, query url.Values) ([]json.RawMessage, error) {
+	items, err := listOnHub(ctx, path, query)
+	if err != nil && identity.FailoverHub(ctx, err) {
+		items, err = listOnHub(ctx, path, query)
+	}
+	if err == nil {
+		return items, nil
+	}
+	if !errors.Is(err, identity.ErrNoHubSession) && !kubeapi.IsUnauthorized(err) {
+		return nil, fmt.Errorf("Hub request failed: %w", err)
+	}
+	// No or expired session → ensure login and retry once
+	if loginErr := identity.EnsureHubLogin(ctx); loginErr != nil {
+		return nil, fmt.Errorf("Hub connection required (login failed): %w", loginErr)
+	}
+	items, err = listOnHub(ctx, path, query)
+	if err != nil {
+		return nil, fmt.Errorf("Hub request after login failed: %w", err)
+	}
+	return items, nil
+}
+
+// listOnHub lists a collection with the stored hub session, without login handling.
+func listOnHub(ctx context.Context, path string, query url.Values) ([]json.RawMessage, error) {
+	client, err := identity.HubClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.List(ctx, path, query)
 }
 
 func GetCluster(ctx context.Context, name string) (Cluster, error) {
@@ -154,7 +281,16 @@ func GetCluster(ctx context.Context, name string) (Cluster, error) {
 			return c, nil
 		}
 	}
-	return Cluster{}, fmt.Errorf("Cluster %s not found", name)
+	return Cluster{}, &NotFoundError{Name: name}
+}
+
+// NotFoundError is returned by GetCluster if the hub does not know the cluster.
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("Cluster %s not found", e.Name)
 }
 
 func mustJSON(v any) []byte {
@@ -0,0 +1,213 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/keystore"
+)
+
+// fakeHub serves the given handlers as the API of a hub and sets up a session with it in a
+// temporary configuration directory.
+func fakeHub(t *testing.T, routes map[string]http.HandlerFunc) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sha256~hub" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "file")
+	t.Setenv("MOC_DISCOVERY_TTL_SECONDS", "0")
+	t.Setenv("MOC_HUB", "")
+	if err := configstate.AddHub(configstate.Hub{Name: "test", URL: srv.URL, Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.SetHubToken("sha256~hub"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const managedClustersPath = "/apis/cluster.open-cluster-management.io/v1/managedclusters"
+
+func TestListManagedClusters(t *testing.T) {
+	ca := base64.StdEncoding.EncodeToString([]byte("-----BEGIN CERTIFICATE-----"))
+	fakeHub(t, map[string]http.HandlerFunc{
+		managedClustersPath: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("continue") == "" {
+				fmt.Fprintf(w, `{"metadata":{"continue":"next"},"items":[{
+					"metadata":{"name":"c1","labels":{"env":"prod","cluster.open-cluster-management.io/clusterset":"east"}},
+					"spec":{"managedClusterClientConfigs":[{"url":"https://api.c1:6443","caBundle":%q},{"url":"https://api-int.c1:6443"}]},
+					"status":{"conditions":[{"type":"ManagedClusterConditionAvailable","status":"True"}]}}]}`, ca)
+				return
+			}
+			fmt.Fprint(w, `{"metadata":{},"items":[{"metadata":{"name":"c2","labels":{"env":"dev"}}}]}`)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta2/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"east"},"spec":{"clusterSelector":{"selectorType":"ExclusiveClusterSetLabel"}}},
+				{"metadata":{"name":"global"},"spec":{"clusterSelector":{"selectorType":"LabelSelector","labelSelector":{}}}}]}`)
+		},
+	})
+
+	clusters, err := ListManagedClusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("got %d clusters: %+v", len(clusters), clusters)
+	}
+	c1, c2 := clusters[0], clusters[1]
+	if c1.Name != "c1" || c1.APIURL != "https://api.c1:6443" || string(c1.CAData) != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("unexpected c1: %+v", c1)
+	}
+	if len(c1.Endpoints) != 2 || c1.Endpoints[1].URL != "https://api-int.c1:6443" {
+		t.Errorf("unexpected endpoints of c1: %+v", c1.Endpoints)
+	}
+	if !reflect.DeepEqual(c1.ClusterSets, []string{"east", "global"}) || !reflect.DeepEqual(c2.ClusterSets, []string{"global"}) {
+		t.Errorf("cluster sets: c1 %q, c2 %q", c1.ClusterSets, c2.ClusterSets)
+	}
+	if c2.APIURL != "" || c2.Labels["env"] != "dev" {
+		t.Errorf("unexpected c2: %+v", c2)
+	}
+	if sets, err := ListClusterSets(context.Background()); err != nil || !reflect.DeepEqual(sets, []string{"east", "global"}) {
+		t.Errorf("ListClusterSets = %q, %v", sets, err)
+	}
+	if cached := CachedClusters(); len(cached) != 2 {
+		t.Errorf("cache not written: %+v", cached)
+	}
+	if _, err := GetCluster(context.Background(), "c3"); err == nil {
+		t.Error("expected an error for an unknown cluster")
+	}
+}
+
+func TestClusterSetFallback(t *testing.T) {
+	var v1beta2 bool
+	fakeHub(t, map[string]http.HandlerFunc{
+		managedClustersPath: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"c1","labels":{"region":"eu"}}}]}`)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta2/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			v1beta2 = true
+			http.NotFound(w, r)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta1/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"eu"},"spec":{"clusterSelector":{"selectorType":"LabelSelector",
+				"labelSelector":{"matchLabels":{"region":"eu"}}}}}]}`)
+		},
+	})
+
+	clusters, err := ListManagedClusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v1beta2 {
+		t.Error("v1beta2 was not tried first")
+	}
+	if len(clusters) != 1 || !reflect.DeepEqual(clusters[0].ClusterSets, []string{"eu"}) {
+		t.Errorf("got %+v", clusters)
+	}
+}
+
+func TestClusterSetsForbidden(t *testing.T) {
+	fakeHub(t, map[string]http.HandlerFunc{
+		managedClustersPath: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"c1","labels":{"cluster.open-cluster-management.io/clusterset":"east"}}}]}`)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta2/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta1/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("v1beta1 must only be tried if v1beta2 does not exist")
+		},
+	})
+
+	clusters, err := ListManagedClusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || !reflect.DeepEqual(clusters[0].ClusterSets, []string{"east"}) {
+		t.Errorf("got %+v", clusters)
+	}
+}
+
+func TestClusterSetsNotServed(t *testing.T) {
+	fakeHub(t, map[string]http.HandlerFunc{
+		managedClustersPath: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"c1","labels":{"cluster.open-cluster-management.io/clusterset":"east"}}}]}`)
+		},
+	})
+
+	clusters, err := ListManagedClusters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || !reflect.DeepEqual(clusters[0].ClusterSets, []string{"east"}) {
+		t.Errorf("got %+v", clusters)
+	}
+}
+
+func TestClusterSetsDecodeError(t *testing.T) {
+	fakeHub(t, map[string]http.HandlerFunc{
+		managedClustersPath: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"c1"}}]}`)
+		},
+		"/apis/cluster.open-cluster-management.io/v1beta2/managedclustersets": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"global"},"spec":{"clusterSelector":"all"}}]}`)
+		},
+	})
+
+	if _, err := ListManagedClusters(context.Background()); err == nil {
+		t.Error("expected an error for ManagedClusterSets that cannot be decoded")
+	}
+}
+
+func TestPlacementClusters(t *testing.T) {
+	fakeHub(t, map[string]http.HandlerFunc{
+		"/apis/cluster.open-cluster-management.io/v1beta1/namespaces/apps/placementdecisions": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("labelSelector") {
+			case PlacementLabel + "=web":
+				fmt.Fprint(w, `{"items":[
+					{"status":{"decisions":[{"clusterName":"c1"},{"clusterName":"c2"}]}},
+					{"status":{"decisions":[{"clusterName":"c2"},{"clusterName":"c3"},{"clusterName":""}]}}]}`)
+			default:
+				fmt.Fprint(w, `{"items":[]}`)
+			}
+		},
+	})
+
+	names, err := PlacementClusters(context.Background(), "apps", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c1", "c2", "c3"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("PlacementClusters = %q, want %q", names, want)
+	}
+	if _, err := PlacementClusters(context.Background(), "apps", "none"); err == nil {
+		t.Error("expected an error for a Placement without decisions")
+	}
+}
+
+func TestParsePlacementRef(t *testing.T) {
+	if ns, name, err := ParsePlacementRef("apps/web"); err != nil || ns != "apps" || name != "web" {
+		t.Errorf("got %q, %q, %v", ns, name, err)
+	}
+	for _, ref := range []string{"web", "/web", "apps/", "a/b/c"} {
+		if _, _, err := ParsePlacementRef(ref); err == nil {
+			t.Errorf("ParsePlacementRef(%q): expected an error", ref)
+		}
+	}
+}
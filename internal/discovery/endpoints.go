@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// endpointsFile remembers per cluster which API URL worked last. It lives next to the discovery
+// cache of the hub but outlives its TTL.
+const endpointsFile = "endpoints.json"
+
+var endpointsMu sync.Mutex
+
+func endpointsPath() (string, error) {
+	cp, err := cachePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cp), endpointsFile), nil
+}
+
+func readEndpoints() map[string]string {
+	m := make(map[string]string)
+	p, err := endpointsPath()
+	if err != nil {
+		return m
+	}
+	if b, err := os.ReadFile(p); err == nil {
+		_ = json.Unmarshal(b, &m)
+	}
+	return m
+}
+
+// RememberedEndpoint returns the API URL that worked last for a cluster, or "".
+func RememberedEndpoint(clusterName string) string {
+	endpointsMu.Lock()
+	defer endpointsMu.Unlock()
+	return readEndpoints()[clusterName]
+}
+
+// RememberEndpoint records the API URL that worked for a cluster; "" forgets it.
+func RememberEndpoint(clusterName, apiURL string) error {
+	endpointsMu.Lock()
+	defer endpointsMu.Unlock()
+	m := readEndpoints()
+	if m[clusterName] == apiURL {
+		return nil
+	}
+	if apiURL == "" {
+		delete(m, clusterName)
+	} else {
+		m[clusterName] = apiURL
+	}
+	p, err := endpointsPath()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, mustJSON(m), 0o600)
+}
+
+// withRememberedEndpoints makes the remembered endpoint of every cluster the one in use.
+func withRememberedEndpoints(clusters []Cluster) []Cluster {
+	m := readEndpoints()
+	for i, c := range clusters {
+		for _, e := range c.Endpoints {
+			if e.URL == m[c.Name] {
+				clusters[i] = c.WithEndpoint(e)
+				break
+			}
+		}
+	}
+	return clusters
+}
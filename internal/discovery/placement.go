@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"multi-oc/internal/kubeapi"
+)
+
+// PlacementLabel links a PlacementDecision to its Placement.
+const PlacementLabel = "cluster.open-cluster-management.io/placement"
+
+type placementDecision struct {
+	Status struct {
+		Decisions []struct {
+			ClusterName string `json:"clusterName"`
+		} `json:"decisions"`
+	} `json:"status"`
+}
+
+// ParsePlacementRef splits "<namespace>/<name>" into its parts.
+func ParsePlacementRef(ref string) (string, string, error) {
+	ns, name, ok := strings.Cut(ref, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid placement %q, expected <namespace>/<name>", ref)
+	}
+	return ns, name, nil
+}
+
+// PlacementClusters returns the names of the clusters selected by a Placement, read live
+// from its PlacementDecisions on the hub. Decisions are not cached since they change with
+// the fleet and the Placement's rollout strategy.
+func PlacementClusters(ctx context.Context, namespace, name string) ([]string, error) {
+	path := "/apis/cluster.open-cluster-management.io/v1beta1/namespaces/" + url.PathEscape(namespace) + "/placementdecisions"
+	raw, err := hubList(ctx, path, url.Values{"labelSelector": {PlacementLabel + "=" + name}})
+	if err != nil {
+		return nil, err
+	}
+	var decisions []placementDecision
+	if err := kubeapi.DecodeItems(raw, &decisions); err != nil {
+		return nil, err
+	}
+	if len(decisions) == 0 {
+		return nil, fmt.Errorf("no PlacementDecisions found for Placement %s/%s", namespace, name)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, it := range decisions {
+		for _, d := range it.Status.Decisions {
+			if d.ClusterName != "" && !seen[d.ClusterName] {
+				seen[d.ClusterName] = true
+				names = append(names, d.ClusterName)
+			}
+		}
+	}
+	return names, nil
+}
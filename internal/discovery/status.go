@@ -0,0 +1,75 @@
+package discovery
+
+// ManagedCluster condition types and reasons set by the ACM registration controllers.
+const (
+	ConditionAvailable = "ManagedClusterConditionAvailable"
+	ConditionJoined    = "ManagedClusterJoined"
+	ConditionAccepted  = "HubAcceptedManagedCluster"
+
+	// ReasonLeaseUpdateStopped marks a cluster whose agent stopped renewing its lease on the hub.
+	ReasonLeaseUpdateStopped = "ManagedClusterLeaseUpdateStopped"
+)
+
+// Status summarizes the ManagedCluster conditions that decide whether a cluster is reachable.
+// Condition values are "True", "False", "Unknown", or empty if the condition is not reported.
+type Status struct {
+	Available string `json:"available,omitempty"`
+	Joined    string `json:"joined,omitempty"`
+	Accepted  string `json:"accepted,omitempty"`
+	// Reason and Message of the Available condition, e.g. ManagedClusterLeaseUpdateStopped.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func parseStatus(conds []condition) Status {
+	var st Status
+	for _, c := range conds {
+		switch c.Type {
+		case ConditionAvailable:
+			st.Available = c.Status
+			st.Reason = c.Reason
+			st.Message = c.Message
+		case ConditionJoined:
+			st.Joined = c.Status
+		case ConditionAccepted:
+			st.Accepted = c.Status
+		}
+	}
+	return st
+}
+
+// IsAvailable reports whether the hub currently considers the cluster available.
+func (c Cluster) IsAvailable() bool {
+	return c.Status.Available == "True"
+}
+
+// LeaseStopped reports whether the cluster's agent stopped renewing its lease on the hub.
+func (c Cluster) LeaseStopped() bool {
+	return c.Status.Reason == ReasonLeaseUpdateStopped
+}
+
+// Unavailability returns a short human readable reason why the cluster is not available,
+// or "" if it is.
+func (c Cluster) Unavailability() string {
+	switch {
+	case c.IsAvailable():
+		return ""
+	case c.LeaseStopped():
+		return "lease update stopped"
+	case c.Status.Accepted == "False":
+		return "not accepted by the hub"
+	case c.Status.Joined == "False":
+		return "not joined"
+	case c.Status.Available == "":
+		return "availability unknown"
+	default:
+		return "available=" + c.Status.Available
+	}
+}
@@ -0,0 +1,228 @@
+package fanout
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultParallel is the number of concurrent oc invocations used when no limit is given.
+const DefaultParallel = 10
+
+// Target is a single oc invocation: the cluster it belongs to and the complete
+// argument list (auth args followed by the user's oc args).
+type Target struct {
+	Cluster string
+	Args    []string
+	// Err is set when the target could not be prepared (e.g. missing API URL).
+	// Such targets are not executed and are reported as failed.
+	Err error
+}
+
+// Result holds the captured outcome of one oc invocation.
+type Result struct {
+	Cluster  string
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	Err      error
+	Duration time.Duration
+}
+
+// OK reports whether the invocation succeeded.
+func (r Result) OK() bool {
+	return r.Err == nil && r.ExitCode == 0
+}
+
+// Each calls fn(i) for i in [0, n) with at most parallel concurrent calls and waits for all of them.
+func Each(n, parallel int, fn func(i int)) {
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Run executes oc for all targets with at most parallel concurrent processes.
+// onDone (optional) is called once per target as soon as it finishes; calls are serialized.
+// The returned results are in the same order as targets.
+func Run(ctx context.Context, targets []Target, parallel int, onDone func(Result)) []Result {
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+	results := make([]Result, len(targets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			var r Result
+			if t.Err != nil {
+				r = Result{Cluster: t.Cluster, ExitCode: -1, Err: t.Err}
+			} else {
+				sem <- struct{}{}
+				r = runOne(ctx, t)
+				<-sem
+			}
+			results[i] = r
+			if onDone != nil {
+				mu.Lock()
+				onDone(r)
+				mu.Unlock()
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+func runOne(ctx context.Context, t Target) Result {
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "oc", t.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	r := Result{
+		Cluster:  t.Cluster,
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			r.ExitCode = ee.ExitCode()
+		} else {
+			r.ExitCode = -1
+			r.Err = err
+		}
+		if ctx.Err() != nil {
+			r.Err = ctx.Err()
+		}
+	}
+	return r
+}
+
+// WritePrefixed writes stdout and stderr of r line by line, each line prefixed with "<cluster>: ".
+func WritePrefixed(stdout, stderr io.Writer, r Result) {
+	prefix := r.Cluster + ": "
+	writeLines(stdout, prefix, r.Stdout)
+	writeLines(stderr, prefix, r.Stderr)
+	if r.Err != nil {
+		fmt.Fprintf(stderr, "%s%v\n", prefix, r.Err)
+	}
+}
+
+func writeLines(w io.Writer, prefix string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		fmt.Fprintf(w, "%s%s\n", prefix, sc.Text())
+	}
+}
+
+// WriteSummary prints a per-cluster success/failure summary.
+func WriteSummary(w io.Writer, results []Result) {
+	var ok, failed []string
+	byName := make(map[string]Result, len(results))
+	for _, r := range results {
+		byName[r.Cluster] = r
+		if r.OK() {
+			ok = append(ok, r.Cluster)
+		} else {
+			failed = append(failed, r.Cluster)
+		}
+	}
+	sort.Strings(ok)
+	sort.Strings(failed)
+	fmt.Fprintf(w, "\nSummary: %d succeeded, %d failed (of %d)\n", len(ok), len(failed), len(results))
+	if len(ok) > 0 {
+		fmt.Fprintf(w, "  OK:     %s\n", strings.Join(ok, ", "))
+	}
+	for _, name := range failed {
+		r := byName[name]
+		reason := fmt.Sprintf("exit %d", r.ExitCode)
+		if r.Err != nil {
+			reason = r.Err.Error()
+		}
+		fmt.Fprintf(w, "  FAILED: %s (%s)\n", name, reason)
+	}
+}
+
+// Failed returns the number of failed results.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if !r.OK() {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteCollapsed groups clusters whose output (stdout, stderr and exit status) is byte-identical
+// and prints each distinct output once, headed by the clusters that produced it (like "clush -b").
+// Larger groups come first, so odd-one-out clusters end up at the bottom.
+func WriteCollapsed(w io.Writer, results []Result) {
+	type group struct {
+		clusters []string
+		r        Result
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, r := range results {
+		key := fmt.Sprintf("%d\x00%v\x00%s\x00%s", r.ExitCode, r.Err, r.Stdout, r.Stderr)
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{r: r}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.clusters = append(g.clusters, r.Cluster)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].clusters) > len(groups[j].clusters)
+	})
+	for _, g := range groups {
+		sort.Strings(g.clusters)
+		fmt.Fprintln(w, "---------------")
+		fmt.Fprintf(w, "%s (%d)\n", strings.Join(g.clusters, ","), len(g.clusters))
+		if !g.r.OK() {
+			reason := fmt.Sprintf("exit %d", g.r.ExitCode)
+			if g.r.Err != nil {
+				reason = g.r.Err.Error()
+			}
+			fmt.Fprintf(w, "FAILED (%s)\n", reason)
+		}
+		fmt.Fprintln(w, "---------------")
+		out := append(append([]byte(nil), g.r.Stdout...), g.r.Stderr...)
+		w.Write(out)
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"multi-oc/internal/discovery"
 	"multi-oc/internal/identity"
+	"multi-oc/internal/keystore"
 )
 
 type secret struct {
@@ -18,16 +19,21 @@ type secret struct {
 }
 
 // WriteClusterKubeconfig fetches the admin-kubeconfig Secret from the hub for the given cluster
-// and writes it to ~/.config/multi-oc/kubeconfigs/<cluster>.kubeconfig.
+// and writes it to ~/.config/multi-oc/kubeconfigs/<hub-id>/<cluster>.kubeconfig.
 // Returns true if a kubeconfig was written.
 func WriteClusterKubeconfig(ctx context.Context, c discovery.Cluster) (bool, error) {
 	if c.Name == "" {
 		return false, fmt.Errorf("cluster name is empty")
 	}
-	if err := identity.EnsureHubLogin(ctx); err != nil {
+	if !identity.HasHubSession() {
+		if err := identity.EnsureHubLogin(ctx); err != nil {
+			return false, err
+		}
+	}
+	cmd, err := identity.HubCommand(ctx, "get", "secret", "admin-kubeconfig", "-n", c.Name, "-o", "json")
+	if err != nil {
 		return false, err
 	}
-	cmd := exec.CommandContext(ctx, "oc", "get", "secret", "admin-kubeconfig", "-n", c.Name, "-o", "json")
 	out, err := cmd.Output()
 	if err != nil {
 		return false, nil
@@ -77,12 +83,45 @@ func WriteAllKubeconfigs(ctx context.Context) (int, error) {
 	return written, nil
 }
 
-func defaultPath(clusterName string) (string, error) {
-	home, err := os.UserHomeDir()
+// RemoveClusterKubeconfig deletes a kubeconfig fetched by WriteClusterKubeconfig.
+// Returns true if one was removed.
+func RemoveClusterKubeconfig(clusterName string) (bool, error) {
+	target, err := defaultPath(clusterName)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(target); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveAllKubeconfigs deletes all kubeconfigs fetched by WriteClusterKubeconfig and returns how many were removed.
+func RemoveAllKubeconfigs() (int, error) {
+	sample, err := defaultPath("x")
+	if err != nil {
+		return 0, err
+	}
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(sample), "*.kubeconfig"))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	return filepath.Join(home, ".config", "multi-oc", "kubeconfigs", clusterName+".kubeconfig"), nil
+	removed := 0
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// defaultPath is the location where moc picks up per-cluster kubeconfigs.
+func defaultPath(clusterName string) (string, error) {
+	return keystore.KubeconfigPath(clusterName)
 }
 
 
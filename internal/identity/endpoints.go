@@ -0,0 +1,82 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/kubeconfig"
+)
+
+// probeTimeout bounds the reachability check of one hub endpoint (MOC_HUB_PROBE_TIMEOUT_SECONDS,
+// default 5s), so that a dead load balancer does not hold up every run.
+func probeTimeout() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("MOC_HUB_PROBE_TIMEOUT_SECONDS")); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// probeEndpoint checks that the hub's API server answers at u (see kubeapi.Probe).
+func probeEndpoint(ctx context.Context, hub configstate.Hub, u string) error {
+	return kubeapi.Probe(ctx, kubeapi.Config{Server: u, CAFile: hub.CAFile, Insecure: hub.Insecure, Timeout: probeTimeout()})
+}
+
+// pickHubEndpoint returns the first endpoint of the hub that answers, starting with the one that
+// answered last, and records it. A hub with a single URL is not probed.
+func pickHubEndpoint(ctx context.Context, hub configstate.Hub) (string, error) {
+	urls := hub.URLs()
+	if len(urls) <= 1 {
+		return hub.Server(), nil
+	}
+	var errs []error
+	for _, u := range urls {
+		err := probeEndpoint(ctx, hub, u)
+		if err == nil {
+			if u != urls[0] {
+				fmt.Fprintf(os.Stderr, "Hub endpoint %s not reachable, using %s.\n", urls[0], u)
+			}
+			return u, configstate.RecordHubEndpoint(u)
+		}
+		errs = append(errs, err)
+	}
+	return "", fmt.Errorf("no endpoint of the hub is reachable: %w", errors.Join(errs...))
+}
+
+// FailoverHub switches the active hub to another endpoint after err, if err means the endpoint
+// in use could not be reached and the hub has alternatives that answer. The hub kubeconfig is
+// pointed at the new endpoint as well. It reports whether the caller should retry.
+func FailoverHub(ctx context.Context, err error) bool {
+	if !kubeapi.IsNetwork(err) {
+		return false
+	}
+	hub, lerr := configstate.LoadHubConfig()
+	if lerr != nil || len(hub.URLs()) <= 1 {
+		return false
+	}
+	failed := hub.Server()
+	alternatives := hub
+	alternatives.LastURL = ""
+	for _, u := range alternatives.URLs() {
+		if u == failed || probeEndpoint(ctx, hub, u) != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Hub endpoint %s not reachable, failing over to %s.\n", failed, u)
+		if configstate.RecordHubEndpoint(u) != nil {
+			return false
+		}
+		if path, perr := configstate.HubKubeconfigPath(); perr == nil {
+			if tok, terr := keystore.GetHubToken(); terr == nil && tok != "" {
+				_ = kubeconfig.Write(path, kubeconfig.Config{Server: u, Token: tok, CAFile: hub.CAFile, Insecure: hub.Insecure})
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -1,7 +1,6 @@
 package identity
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -11,102 +10,232 @@ import (
 	"strings"
 
 	"multi-oc/internal/configstate"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/kubeconfig"
+	"multi-oc/internal/oauth"
+	"multi-oc/internal/prompt"
 	"regexp"
 
 	keyring "github.com/zalando/go-keyring"
 )
 
 const (
-	serviceHubToken = "multi-oc-hub-refresh-token"
+	legacyServiceHubToken = "multi-oc-hub-refresh-token"
 )
 
-// LoginHub runs an oc login using a token.
+// ErrNoHubSession is returned by HubClient when no hub token is stored.
+var ErrNoHubSession = errors.New("no hub session; run 'moc login'")
+
+// LoginHub verifies the token against the hub, writes it into the moc-owned hub kubeconfig (0600)
+// and stores it for direct hub API calls. The token is never passed to oc on the command line.
 func LoginHub(ctx context.Context, hubURL string, insecure bool, caFile string, token string) error {
 	if hubURL == "" {
 		return fmt.Errorf("hubURL is empty")
 	}
-	args := []string{"login", "--server", hubURL}
 	if token == "" {
 		return fmt.Errorf("token is required for hub login")
 	}
-	args = append(args, "--token", token)
-	if insecure {
-		args = append(args, "--insecure-skip-tls-verify=true")
+	client, err := kubeapi.New(kubeapi.Config{Server: hubURL, Token: token, CAFile: caFile, Insecure: insecure})
+	if err != nil {
+		return err
+	}
+	var user struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := client.Get(ctx, "/apis/user.openshift.io/v1/users/~", nil, &user); err != nil {
+		if kubeapi.IsUnauthorized(err) {
+			return fmt.Errorf("hub login failed: token rejected by %s", hubURL)
+		}
+		return fmt.Errorf("hub login failed: %w", err)
+	}
+	path, err := configstate.HubKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	if err := kubeconfig.Write(path, kubeconfig.Config{Server: hubURL, Token: token, CAFile: caFile, Insecure: insecure}); err != nil {
+		return err
+	}
+	if err := configstate.SaveHubConfig(configstate.Hub{URL: hubURL, CAFile: caFile, Insecure: insecure}); err != nil {
+		return err
+	}
+	if err := keystore.SetHubToken(token); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged into %q as %q.\n", hubURL, user.Metadata.Name)
+	return nil
+}
+
+// HubCommand returns an oc command against the hub, using the moc-owned hub kubeconfig
+// instead of whatever context the user's default kubeconfig points to.
+func HubCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	kubeconfig, err := configstate.HubKubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, "oc", append([]string{"--kubeconfig", kubeconfig}, args...)...), nil
+}
+
+// HasHubSession reports whether a hub login has been stored (hub kubeconfig present).
+func HasHubSession() bool {
+	kubeconfig, err := configstate.HubKubeconfigPath()
+	if err != nil {
+		return false
 	}
-	if caFile != "" {
-		args = append(args, "--certificate-authority", caFile)
+	st, err := os.Stat(kubeconfig)
+	return err == nil && !st.IsDir()
+}
+
+// HubClient returns an API client for the hub, authenticated with the token stored by LoginHub.
+// It returns ErrNoHubSession if no token is stored.
+func HubClient() (*kubeapi.Client, error) {
+	hub, err := configstate.LoadHubConfig()
+	if err != nil {
+		return nil, err
+	}
+	if hub.URL == "" {
+		return nil, errors.New("no hub configured; run 'moc login --hub <url>'")
 	}
-	cmd := exec.CommandContext(ctx, "oc", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	tok, err := keystore.GetHubToken()
+	if err != nil {
+		return nil, err
+	}
+	if tok == "" {
+		return nil, ErrNoHubSession
+	}
+	return kubeapi.New(kubeapi.Config{Server: hub.Server(), Token: tok, CAFile: hub.CAFile, Insecure: hub.Insecure})
 }
 
-// EnsureHubLogin ensures there is a valid oc session to the hub.
-// If no hub URL is configured, it prompts for it and saves it.
-// It uses a headless flow: prints an OAuth URL to obtain a token and prompts for it.
+// LoginOptions are the flags of "moc login". Logins that become necessary during other commands
+// take them from the environment (see EnsureHubLogin).
+type LoginOptions struct {
+	// Username logs in with username and password instead of the browser or a pasted token.
+	Username string
+	// CAFile and Insecure override the TLS settings remembered from the last login; Insecure is
+	// nil if not given.
+	CAFile   string
+	Insecure *bool
+}
+
+// LoginOptionsFromEnv returns the login options given through the environment:
 //
-//	MOC_HUB_INSECURE=true    → --insecure-skip-tls-verify
-//	MOC_HUB_CA_FILE=/path    → --certificate-authority
+//	MOC_HUB_USERNAME=alice   → username/password login
+//	MOC_HUB_INSECURE=true    → skip TLS verification
+//	MOC_HUB_CA_FILE=/path    → verify the hub with this CA bundle
+func LoginOptionsFromEnv() LoginOptions {
+	o := LoginOptions{
+		Username: strings.TrimSpace(os.Getenv("MOC_HUB_USERNAME")),
+		CAFile:   os.Getenv("MOC_HUB_CA_FILE"),
+	}
+	if v := os.Getenv("MOC_HUB_INSECURE"); v != "" {
+		insecure := v == "true"
+		o.Insecure = &insecure
+	}
+	return o
+}
+
+// EnsureHubLogin logs into the active hub with the options from the environment (see
+// LoginOptionsFromEnv); commands call it when they find the hub session missing or expired.
 func EnsureHubLogin(ctx context.Context) error {
-	hubURL, err := configstate.LoadHub()
+	return Login(ctx, LoginOptionsFromEnv())
+}
+
+// Login logs into the active hub. If no hub is configured, it prompts for its URL and adds it. A
+// hub with several API endpoints is logged into through the first one that is reachable.
+// With a user name it asks for the password and obtains a token from the hub's OAuth server;
+// otherwise it opens a browser login if a display is available (see oauth.BrowserAvailable). If
+// neither works it prints an OAuth URL and prompts for a token.
+func Login(ctx context.Context, o LoginOptions) error {
+	hub, err := configstate.LoadHubConfig()
 	if err != nil {
 		return err
 	}
-	if strings.TrimSpace(hubURL) == "" {
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Fprint(os.Stderr, "Hub API URL (e.g., https://api.hub.example:6443): ")
-		line, _ := reader.ReadString('\n')
-		hubURL = strings.TrimSpace(line)
+	if strings.TrimSpace(hub.URL) == "" {
+		hubURL := strings.TrimSpace(prompt.Line("Hub API URL (e.g., https://api.hub.example:6443): "))
 		hubURL = strings.TrimPrefix(hubURL, "@")
 		if hubURL == "" {
 			return fmt.Errorf("hub API URL is required")
 		}
-		if err := configstate.SaveHub(hubURL); err != nil {
+		name, err := configstate.SelectHub(hubURL)
+		if err != nil {
+			return err
+		}
+		configstate.SetActiveHub(name)
+		if hub, err = configstate.LoadHubConfig(); err != nil {
 			return err
 		}
 	}
-	insecure := os.Getenv("MOC_HUB_INSECURE") == "true"
-	caFile := os.Getenv("MOC_HUB_CA_FILE")
-	// Headless flow: print OAuth token URL and prompt for token, then use --token
+	// The options override the TLS settings remembered from the last login
+	if o.Insecure != nil {
+		hub.Insecure = *o.Insecure
+	}
+	if o.CAFile != "" {
+		hub.CAFile = o.CAFile
+	}
+	insecure, caFile := hub.Insecure, hub.CAFile
+	// With several endpoints, log in through the first one that answers
+	hubURL, err := pickHubEndpoint(ctx, hub)
+	if err != nil {
+		return err
+	}
+	// Username/password via the OAuth challenge flow, if a user name is given
+	if user := strings.TrimSpace(o.Username); user != "" {
+		password, err := prompt.Password(fmt.Sprintf("Password for %s on the hub: ", user))
+		if err != nil {
+			return err
+		}
+		tok, err := oauth.ChallengeToken(ctx, kubeapi.Config{Server: hubURL, CAFile: caFile, Insecure: insecure}, user, password)
+		if err == nil {
+			return LoginHub(ctx, hubURL, insecure, caFile, tok.AccessToken)
+		}
+		if errors.Is(err, oauth.ErrBadCredentials) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Password login to the hub not possible: %v\n", err)
+	} else if oauth.BrowserAvailable(ctx) {
+		tok, err := oauth.BrowserToken(ctx, kubeapi.Config{Server: hubURL, CAFile: caFile, Insecure: insecure})
+		if err == nil {
+			return LoginHub(ctx, hubURL, insecure, caFile, tok.AccessToken)
+		}
+		fmt.Fprintf(os.Stderr, "Browser login to the hub failed: %v\n", err)
+	}
+	// Headless flow: print OAuth token URL and prompt for token
 	hint := deriveOAuthTokenURL(hubURL)
 	if hint != "" {
 		fmt.Fprintf(os.Stderr, "Open in a browser (from any machine with access):\n  %s\nSign in there, copy the token (starting with 'sha256~') and paste it here.\n", hint)
 	} else {
 		fmt.Fprintln(os.Stderr, "OpenShift token URL could not be derived from the hub API URL. Please obtain an OAuth token from the OpenShift Web Console and paste it here (sha256~...).")
 	}
-	fmt.Fprint(os.Stderr, "Token: ")
-	stdin := bufio.NewReader(os.Stdin)
-	line, _ := stdin.ReadString('\n')
-	token := sanitizeToken(line)
+	token := sanitizeToken(prompt.Line("Token: "))
 	if token == "" {
 		return fmt.Errorf("no valid token detected")
 	}
 	return LoginHub(ctx, hubURL, insecure, caFile, token)
 }
 
-func GetHubRefreshToken() (string, string, error) {
-	hubURL, err := configstate.LoadHub()
-	if err != nil {
-		return "", "", err
-	}
-	if hubURL == "" {
-		return "", "", errors.New("no hub configured; run 'moc login --hub <url>'")
+// LogoutHub revokes the hub token on the server and removes it together with the hub kubeconfig.
+// The hub URL and its TLS settings are kept so that "moc login" does not ask for them again.
+// The local session is removed even if revocation fails; that error is returned afterwards.
+func LogoutHub(ctx context.Context) error {
+	hub, err := configstate.LoadHubConfig()
+	if err != nil || hub.URL == "" {
+		return err
 	}
-	tok, err := keyring.Get(serviceHubToken, hubURL)
-	if err != nil {
-		return "", "", err
+	var revokeErr error
+	if client, err := HubClient(); err == nil {
+		revokeErr = client.RevokeToken(ctx)
 	}
-	return hubURL, tok, nil
-}
-
-func LogoutHub() error {
-	hubURL, err := configstate.LoadHub()
-	if err != nil || hubURL == "" {
-		return nil
+	_ = keystore.DeleteHubToken()
+	// Written by older versions that used a refresh token
+	_ = keyring.Delete(legacyServiceHubToken, hub.URL)
+	if path, err := configstate.HubKubeconfigPath(); err == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
-	_ = keyring.Delete(serviceHubToken, hubURL)
-	return nil
+	return revokeErr
 }
 
 // sanitizeToken extracts a valid OpenShift token if present, tolerating various wrapper text.
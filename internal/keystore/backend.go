@@ -0,0 +1,227 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	keyring "github.com/zalando/go-keyring"
+
+	"multi-oc/internal/configstate"
+)
+
+// Backend stores credentials. Secrets are addressed like keyring entries: by service
+// (serviceTargetToken, serviceHubToken) and account ("<hub-id>/<cluster>" or the hub ID).
+type Backend interface {
+	// Name is the name the backend is selected with.
+	Name() string
+	// Get returns the stored secret, or "" if there is none.
+	Get(service, account string) (string, error)
+	Set(service, account, secret string) error
+	// Delete removes the secret; removing a missing secret is not an error.
+	Delete(service, account string) error
+}
+
+// ParseBackend returns the backend for a name from configstate.BackendNames.
+func ParseBackend(spec string) (Backend, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return autoBackend{}, nil
+	case "keyring":
+		return keyringBackend{}, nil
+	case "file":
+		return fileBackend{}, nil
+	case "encrypted":
+		return fileBackend{encrypted: true}, nil
+	case "pass":
+		return passBackend{}, nil
+	case "vault":
+		return vaultBackend{}, nil
+	case "helper":
+		if arg == "" {
+			arg = os.Getenv("MOC_CREDENTIAL_HELPER")
+		}
+		if strings.TrimSpace(arg) == "" {
+			return nil, fmt.Errorf("credential backend helper needs a command (helper:<command> or MOC_CREDENTIAL_HELPER)")
+		}
+		return helperBackend{command: arg}, nil
+	}
+	return nil, fmt.Errorf("unknown credential backend %q (expected one of %s)", spec, strings.Join(configstate.BackendNames, ", "))
+}
+
+// clusterLabels looks up the labels of a cluster by name, for the label rules of config.yaml
+// (see SetClusterLabels); without it only rules of the cluster's own entry apply.
+var clusterLabels func(clusterName string) map[string]string
+
+// SetClusterLabels sets how the labels of a cluster are looked up, so that label rules in
+// config.yaml can choose the backend of its token. It is set once at startup, before tokens are
+// accessed.
+func SetClusterLabels(f func(clusterName string) map[string]string) {
+	clusterLabels = f
+}
+
+// BackendSpec returns the configured backend name for a cluster's tokens ("" for the hub token):
+// MOC_CREDENTIAL_BACKEND, else credentialBackend from config.yaml (the cluster's entry, matching
+// label rules, then the defaults), else "auto".
+func BackendSpec(clusterName string) string {
+	if v := strings.TrimSpace(os.Getenv("MOC_CREDENTIAL_BACKEND")); v != "" {
+		return v
+	}
+	clusterName = tokenCluster(clusterName)
+	var lbls map[string]string
+	if clusterName != "" && clusterLabels != nil {
+		lbls = clusterLabels(clusterName)
+	}
+	s, err := configstate.ClusterSettings(clusterName, lbls)
+	if err != nil || s.CredentialBackend == "" {
+		return "auto"
+	}
+	return s.CredentialBackend
+}
+
+// BackendFor returns the configured credential backend for a cluster ("" for the hub token).
+func BackendFor(clusterName string) (Backend, error) {
+	return ParseBackend(BackendSpec(clusterName))
+}
+
+// autoBackend is the default: the OS keyring if available, otherwise a file (encrypted if
+// encryption is set up, see encrypted.go).
+type autoBackend struct{}
+
+func (autoBackend) Name() string { return "auto" }
+
+func (autoBackend) Get(service, account string) (string, error) {
+	if tok, err := keyring.Get(service, account); err == nil && tok != "" {
+		return tok, nil
+	}
+	return fileBackend{}.Get(service, account)
+}
+
+func (autoBackend) Set(service, account, secret string) error {
+	if err := keyring.Set(service, account, secret); err == nil {
+		return nil
+	}
+	return fileBackend{}.Set(service, account, secret)
+}
+
+func (autoBackend) Delete(service, account string) error {
+	_ = keyring.Delete(service, account)
+	return fileBackend{}.Delete(service, account)
+}
+
+// keyringBackend uses the OS keyring only (Secret Service, macOS Keychain, Windows Credential Manager).
+type keyringBackend struct{}
+
+func (keyringBackend) Name() string { return "keyring" }
+
+func (keyringBackend) Get(service, account string) (string, error) {
+	tok, err := keyring.Get(service, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	}
+	return tok, err
+}
+
+func (keyringBackend) Set(service, account, secret string) error {
+	if err := keyring.Set(service, account, secret); err != nil {
+		return fmt.Errorf("OS keyring not available: %w", err)
+	}
+	return nil
+}
+
+func (keyringBackend) Delete(service, account string) error {
+	if err := keyring.Delete(service, account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// fileBackend stores secrets in 0600 files below ~/.config/multi-oc. With encrypted set, files
+// are always encrypted; otherwise only once encryption has been set up.
+type fileBackend struct {
+	encrypted bool
+}
+
+func (b fileBackend) Name() string {
+	if b.encrypted {
+		return "encrypted"
+	}
+	return "file"
+}
+
+func (fileBackend) Get(service, account string) (string, error) {
+	path, err := secretFilePath(service, account)
+	if err != nil {
+		return "", err
+	}
+	return readSecret(path)
+}
+
+func (b fileBackend) Set(service, account, secret string) error {
+	path, err := secretFilePath(service, account)
+	if err != nil {
+		return err
+	}
+	return writeSecret(path, secret, b.encrypted)
+}
+
+func (fileBackend) Delete(service, account string) error {
+	path, err := secretFilePath(service, account)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// entryName returns a path-like name for a secret in external stores:
+// "tokens/<hub-id>/<cluster>" or "hub/<hub-id>".
+func entryName(service, account string) string {
+	if service == serviceHubToken {
+		return "hub/" + hubFileName(account)
+	}
+	return "tokens/" + account
+}
+
+// MoveTargetToken moves a cluster's token from the backend it was stored in to the currently
+// configured one. The metadata stays as it is.
+func MoveTargetToken(clusterName string, from Backend) error {
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return err
+	}
+	return moveSecret(serviceTargetToken, account, from, clusterName)
+}
+
+// MoveHubToken moves the hub token from the backend it was stored in to the configured one.
+func MoveHubToken(from Backend) error {
+	id, err := hubScope()
+	if err != nil {
+		return err
+	}
+	return moveSecret(serviceHubToken, id, from, "")
+}
+
+func moveSecret(service, account string, from Backend, clusterName string) error {
+	to, err := BackendFor(clusterName)
+	if err != nil {
+		return err
+	}
+	secret, err := from.Get(service, account)
+	if err != nil || secret == "" {
+		return err
+	}
+	// Delete first: file, encrypted and auto share the same token files.
+	if err := from.Delete(service, account); err != nil {
+		return err
+	}
+	if err := to.Set(service, account, secret); err != nil {
+		_ = from.Set(service, account, secret)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package keystore
+
+import (
+	"testing"
+
+	"multi-oc/internal/configstate"
+)
+
+func TestBackendSpecLabelRules(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "")
+	if err := configstate.SetConfigValue("", "env=prod", "credentialBackend", "file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := configstate.SetConfigValue("c3", "", "credentialBackend", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	SetClusterLabels(func(name string) map[string]string {
+		if name == "c1" || name == "c3" {
+			return map[string]string{"env": "prod"}
+		}
+		return nil
+	})
+	t.Cleanup(func() { SetClusterLabels(nil) })
+
+	for name, want := range map[string]string{"c1": "file", "c2": "auto", "c3": "pass", "": "auto", MSAKey("c1"): "file"} {
+		if got := BackendSpec(name); got != want {
+			t.Errorf("BackendSpec(%q) = %q, want %q", name, got, want)
+		}
+	}
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "encrypted")
+	if got := BackendSpec("c1"); got != "encrypted" {
+		t.Errorf("MOC_CREDENTIAL_BACKEND must win, got %q", got)
+	}
+}
@@ -0,0 +1,499 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"multi-oc/internal/prompt"
+)
+
+// Token files written with encryption enabled start with encPrefix, followed by the base64 of
+// nonce and AES-256-GCM ciphertext. The file's directory and name are the additional data, so an
+// encrypted token cannot be moved to another cluster's file.
+const encPrefix = "moc-enc:v1:"
+
+const (
+	encModePassphrase = "passphrase"
+	encModeKeyFile    = "keyfile"
+
+	// kdfArgon2id derives passphrase keys with Argon2id; the parameters of new stores follow the
+	// second recommendation of RFC 9106 (3 passes, 64 MiB, 4 lanes).
+	kdfArgon2id    = "argon2id"
+	argon2Time     = 3
+	argon2MemoryKB = 64 * 1024
+	argon2Threads  = 4
+	// checkPlaintext is encrypted into encryption.json to recognize a wrong passphrase or key file.
+	checkPlaintext = "multi-oc token store"
+	// defaultUnlockTTL is how long an unlocked passphrase key stays cached for the session.
+	defaultUnlockTTL = 8 * time.Hour
+)
+
+// ErrWrongKey is returned if the passphrase or key file does not match the encrypted token store.
+var ErrWrongKey = errors.New("wrong passphrase or key file for the encrypted token store")
+
+// encParams is stored in ~/.config/multi-oc/encryption.json once encryption is enabled. It holds
+// everything needed to derive and verify the key, never the key itself.
+type encParams struct {
+	Mode string `json:"mode"`
+	// KDF, Salt and the cost parameters derive the key of a passphrase store; they are stored so
+	// that new stores can use higher costs without breaking existing ones.
+	KDF     string `json:"kdf,omitempty"`
+	Salt    []byte `json:"salt,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	Check   string `json:"check"`
+}
+
+// unlocked caches the key for the rest of the run; fan-outs read many tokens concurrently.
+var unlocked struct {
+	sync.Mutex
+	key      []byte
+	err      error
+	migrated bool
+}
+
+// requestedEncryption returns the encryption mode asked for in the environment: MOC_TOKEN_ENCRYPTION
+// ("passphrase", "keyfile", "off"), or "keyfile" if only MOC_TOKEN_KEY_FILE is set.
+func requestedEncryption() string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("MOC_TOKEN_ENCRYPTION"))); v {
+	case "", "off", "false", "none":
+		if v == "" && os.Getenv("MOC_TOKEN_KEY_FILE") != "" {
+			return encModeKeyFile
+		}
+		return ""
+	default:
+		return v
+	}
+}
+
+// encryptionEnabled reports whether token files are written encrypted: once the store has been
+// set up (encryption.json exists) it stays encrypted until ResetEncryption.
+func encryptionEnabled() bool {
+	if _, ok, _ := loadEncParams(); ok {
+		return true
+	}
+	return requestedEncryption() != ""
+}
+
+// writeSecret writes a token file, encrypted if encryption is enabled or force is set.
+func writeSecret(path, token string, force bool) error {
+	data := token + "\n"
+	if force || encryptionEnabled() {
+		key, err := unlock()
+		if err != nil {
+			return err
+		}
+		sealed, err := seal(key, aadFor(path), []byte(token))
+		if err != nil {
+			return err
+		}
+		data = sealed + "\n"
+	}
+	return os.WriteFile(path, []byte(data), 0o600)
+}
+
+// readSecret reads a token file, decrypting it if needed. A plaintext file found while encryption
+// is enabled is encrypted in place.
+func readSecret(path string) (string, error) {
+	s, err := readFile(path)
+	if err != nil || s == "" {
+		return s, err
+	}
+	if !strings.HasPrefix(s, encPrefix) {
+		if encryptionEnabled() {
+			if err := writeSecret(path, s, false); err != nil {
+				return "", err
+			}
+		}
+		return s, nil
+	}
+	key, err := unlock()
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(key, aadFor(path), s)
+	if err != nil {
+		return "", fmt.Errorf("decrypting %s: %w", path, err)
+	}
+	return string(plain), nil
+}
+
+// isEncryptedFile reports whether path is an encrypted token file, without decrypting it.
+func isEncryptedFile(path string) bool {
+	s, err := readFile(path)
+	return err == nil && strings.HasPrefix(s, encPrefix)
+}
+
+// Lock forgets the session-cached key of a passphrase-protected token store, so the next access
+// asks for the passphrase again.
+func Lock() error {
+	path, err := sessionKeyPath()
+	if errors.Is(err, errNoRuntimeDir) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ResetEncryption removes the encryption setup (encryption.json and the session key) if no
+// encrypted token files are left, so the next token store starts from MOC_TOKEN_ENCRYPTION again.
+func ResetEncryption() error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	for _, f := range tokenFiles(dir) {
+		if isEncryptedFile(f) {
+			return nil
+		}
+	}
+	if err := Lock(); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, "encryption.json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// unlock returns the key of the token store, setting the store up on first use. Passphrase keys
+// come from the session cache, MOC_TOKEN_PASSPHRASE or a prompt; key files are read from
+// MOC_TOKEN_KEY_FILE. After the first unlock, remaining plaintext token files are encrypted.
+func unlock() ([]byte, error) {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	if unlocked.key != nil {
+		return unlocked.key, nil
+	}
+	if unlocked.err != nil {
+		// do not ask every cluster of a fan-out for the passphrase again
+		return nil, unlocked.err
+	}
+
+	p, ok, err := loadEncParams()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		p = encParams{Mode: requestedEncryption()}
+		if p.Mode == "" {
+			// the encrypted backend was selected without MOC_TOKEN_ENCRYPTION
+			p.Mode = encModePassphrase
+		}
+	}
+	var key []byte
+	switch p.Mode {
+	case encModeKeyFile:
+		key, err = keyFromFile()
+	case encModePassphrase:
+		key, err = keyFromPassphrase(&p, !ok)
+	default:
+		return nil, fmt.Errorf("unknown token encryption %q (expected %s or %s)", p.Mode, encModePassphrase, encModeKeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if plain, err := open(key, nil, p.Check); err != nil || string(plain) != checkPlaintext {
+			_ = Lock()
+			unlocked.err = ErrWrongKey
+			return nil, ErrWrongKey
+		}
+	} else {
+		if p.Check, err = seal(key, nil, []byte(checkPlaintext)); err != nil {
+			return nil, err
+		}
+		if err := saveEncParams(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.Mode == encModePassphrase {
+		cacheSessionKey(key)
+	}
+	unlocked.key = key
+	if !unlocked.migrated {
+		unlocked.migrated = true
+		migratePlaintext(key)
+	}
+	return key, nil
+}
+
+// keyFromPassphrase derives the key from the passphrase. For a new store it generates the salt
+// and asks for the passphrase twice.
+func keyFromPassphrase(p *encParams, create bool) ([]byte, error) {
+	if !create {
+		if key := sessionKey(); key != nil {
+			return key, nil
+		}
+	}
+	pass := os.Getenv("MOC_TOKEN_PASSPHRASE")
+	if pass == "" {
+		msg := "Passphrase for the moc token store: "
+		if create {
+			msg = "New passphrase for the moc token store: "
+		}
+		var err error
+		if pass, err = prompt.Password(msg); err != nil {
+			return nil, err
+		}
+		if pass == "" {
+			return nil, fmt.Errorf("no passphrase entered")
+		}
+		if create {
+			again, err := prompt.Password("Repeat the passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if again != pass {
+				return nil, fmt.Errorf("the passphrases do not match")
+			}
+		}
+	}
+	if create {
+		p.KDF, p.Time, p.Memory, p.Threads = kdfArgon2id, argon2Time, argon2MemoryKB, argon2Threads
+		p.Salt = make([]byte, 16)
+		if _, err := rand.Read(p.Salt); err != nil {
+			return nil, err
+		}
+	}
+	return deriveKey(pass, *p)
+}
+
+// deriveKey derives the 32-byte key of a passphrase store.
+func deriveKey(pass string, p encParams) ([]byte, error) {
+	if p.KDF != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported key derivation %q in encryption.json", p.KDF)
+	}
+	if len(p.Salt) < 16 || p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+		return nil, fmt.Errorf("invalid key derivation parameters in encryption.json")
+	}
+	return argon2.IDKey([]byte(pass), p.Salt, p.Time, p.Memory, p.Threads, 32), nil
+}
+
+// keyFromFile derives the key from the file in MOC_TOKEN_KEY_FILE, creating the file with 32
+// random bytes if it does not exist. Any content works; it is hashed into the key.
+func keyFromFile() ([]byte, error) {
+	path := os.Getenv("MOC_TOKEN_KEY_FILE")
+	if path == "" {
+		return nil, fmt.Errorf("the token store is encrypted with a key file: set MOC_TOKEN_KEY_FILE")
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		b = []byte(base64.StdEncoding.EncodeToString(raw) + "\n")
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Created token key file %s. Keep it out of backups of the token store.\n", path)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	sum := sha256.Sum256(append([]byte("multi-oc token key\x00"), b...))
+	return sum[:], nil
+}
+
+// migratePlaintext encrypts the token files that were written before encryption was enabled.
+func migratePlaintext(key []byte) {
+	dir, err := configDir()
+	if err != nil {
+		return
+	}
+	for _, f := range tokenFiles(dir) {
+		s, err := readFile(f)
+		if err != nil || s == "" || strings.HasPrefix(s, encPrefix) {
+			continue
+		}
+		if sealed, err := seal(key, aadFor(f), []byte(s)); err == nil {
+			_ = os.WriteFile(f, []byte(sealed+"\n"), 0o600)
+		}
+	}
+}
+
+// tokenFiles returns all token files of all hubs, including those of the unscoped layout.
+func tokenFiles(dir string) []string {
+	var files []string
+	for _, pattern := range []string{"tokens/*.token", "tokens/*/*.token", "hub/*.token"} {
+		m, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		files = append(files, m...)
+	}
+	return files
+}
+
+func seal(key, aad, plain []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, aad)), nil
+}
+
+func open(key, aad []byte, sealed string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, encPrefix))
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted token")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aadFor binds an encrypted token to its location, e.g. "<hub-id>/cluster1.token".
+func aadFor(path string) []byte {
+	return []byte(filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path))
+}
+
+func encParamsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "encryption.json"), nil
+}
+
+func loadEncParams() (encParams, bool, error) {
+	path, err := encParamsPath()
+	if err != nil {
+		return encParams{}, false, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return encParams{}, false, nil
+		}
+		return encParams{}, false, err
+	}
+	var p encParams
+	if err := json.Unmarshal(b, &p); err != nil {
+		return encParams{}, false, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return p, true, nil
+}
+
+func saveEncParams(p encParams) error {
+	path, err := encParamsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// unlockTTL returns how long an unlocked key is cached for the session (MOC_UNLOCK_TTL_SECONDS,
+// default 8h; 0 disables the cache).
+func unlockTTL() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("MOC_UNLOCK_TTL_SECONDS")); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultUnlockTTL
+}
+
+// errNoRuntimeDir is returned by sessionKeyPath if the unlocked key cannot be cached.
+var errNoRuntimeDir = errors.New("XDG_RUNTIME_DIR is not set")
+
+// sessionKeyPath returns the session cache of the unlocked key in XDG_RUNTIME_DIR, a per-user
+// tmpfs that is cleared at logout. Without it the key is not cached: a file under the shared temp
+// dir could outlive the session (and reboots, where /tmp is on disk), so the passphrase is asked
+// for on every run instead.
+func sessionKeyPath() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", errNoRuntimeDir
+	}
+	return filepath.Join(dir, "multi-oc-session.key"), nil
+}
+
+// sessionKey returns the cached key, or nil if there is none or it has expired. The file holds
+// the expiry (Unix seconds) and the hex-encoded key.
+func sessionKey() []byte {
+	path, err := sessionKeyPath()
+	if err != nil {
+		return nil
+	}
+	s, err := readFile(path)
+	if err != nil || s == "" {
+		return nil
+	}
+	exp, hexKey, _ := strings.Cut(s, " ")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	key, keyErr := hex.DecodeString(hexKey)
+	if err != nil || keyErr != nil || len(key) != 32 || time.Now().Unix() >= expires ||
+		time.Until(time.Unix(expires, 0)) > unlockTTL() {
+		_ = os.Remove(path)
+		return nil
+	}
+	return key
+}
+
+// cacheSessionKey stores the key for later runs of this session (best effort), expiring after
+// unlockTTL. An existing cache is left alone, so the TTL counts from the passphrase entry.
+func cacheSessionKey(key []byte) {
+	ttl := unlockTTL()
+	if ttl == 0 {
+		return
+	}
+	path, err := sessionKeyPath()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	expires := time.Now().Add(ttl).Unix()
+	_ = os.WriteFile(path, []byte(fmt.Sprintf("%d %s\n", expires, hex.EncodeToString(key))), 0o600)
+}
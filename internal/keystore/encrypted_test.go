@@ -0,0 +1,126 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encryptedStore prepares an empty configuration directory for an encrypted token store and
+// forgets keys unlocked by earlier tests.
+func encryptedStore(t *testing.T, mode string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("MOC_TOKEN_ENCRYPTION", mode)
+	t.Setenv("MOC_UNLOCK_TTL_SECONDS", "")
+	resetUnlocked()
+	t.Cleanup(resetUnlocked)
+	tokens := filepath.Join(dir, "multi-oc", "tokens", "hub1")
+	if err := os.MkdirAll(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func resetUnlocked() {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	unlocked.key, unlocked.err, unlocked.migrated = nil, nil, false
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	tokens := encryptedStore(t, "passphrase")
+	t.Setenv("MOC_TOKEN_PASSPHRASE", "correct horse")
+	path := filepath.Join(tokens, "c1.token")
+	if err := writeSecret(path, "sha256~secret", false); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(raw), encPrefix) || strings.Contains(string(raw), "sha256~secret") {
+		t.Fatalf("token file is not encrypted: %q", raw)
+	}
+	p, ok, err := loadEncParams()
+	if err != nil || !ok || p.KDF != kdfArgon2id || len(p.Salt) != 16 || p.Memory != argon2MemoryKB {
+		t.Fatalf("unexpected encryption.json: %+v, %v, %v", p, ok, err)
+	}
+
+	// a later run derives the key again from the passphrase
+	resetUnlocked()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	got, err := readSecret(path)
+	if err != nil || got != "sha256~secret" {
+		t.Errorf("readSecret = %q, %v", got, err)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	tokens := encryptedStore(t, "passphrase")
+	t.Setenv("MOC_TOKEN_PASSPHRASE", "correct horse")
+	path := filepath.Join(tokens, "c1.token")
+	if err := writeSecret(path, "sha256~secret", false); err != nil {
+		t.Fatal(err)
+	}
+
+	resetUnlocked()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("MOC_TOKEN_PASSPHRASE", "battery staple")
+	if _, err := readSecret(path); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	// the failure is remembered for the rest of the run
+	t.Setenv("MOC_TOKEN_PASSPHRASE", "correct horse")
+	if _, err := unlock(); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected the cached ErrWrongKey, got %v", err)
+	}
+}
+
+func TestEncryptedTokenBoundToPath(t *testing.T) {
+	tokens := encryptedStore(t, "keyfile")
+	t.Setenv("MOC_TOKEN_KEY_FILE", filepath.Join(t.TempDir(), "token.key"))
+	path := filepath.Join(tokens, "c1.token")
+	if err := writeSecret(path, "sha256~secret", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readSecret(path); err != nil || got != "sha256~secret" {
+		t.Fatalf("readSecret = %q, %v", got, err)
+	}
+	moved := filepath.Join(tokens, "c2.token")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSecret(moved); err == nil {
+		t.Error("a token moved to another cluster's file must not decrypt")
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	encryptedStore(t, "passphrase")
+	key := make([]byte, 32)
+	cacheSessionKey(key)
+	if got := sessionKey(); got == nil {
+		t.Fatal("key not cached")
+	}
+	path, _ := sessionKeyPath()
+	if err := os.WriteFile(path, []byte("1 "+strings.Repeat("00", 32)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if sessionKey() != nil {
+		t.Error("an expired key must not be used")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("an expired key must be removed")
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	cacheSessionKey(key)
+	if sessionKey() != nil {
+		t.Error("without XDG_RUNTIME_DIR the key must not be cached")
+	}
+	if err := Lock(); err != nil {
+		t.Errorf("Lock without XDG_RUNTIME_DIR: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// helperBackend delegates to an external command, in the style of git credential helpers. The
+// command is run through "sh -c" with the operation (get, store or erase) appended as argument and
+// receives key=value lines on stdin, terminated by an empty line:
+//
+//	service=multi-oc-target-token
+//	account=<hub-id>/cluster1   (the hub ID for the hub token)
+//	secret=sha256~...        (store only)
+//
+// For get it prints "secret=<value>" (other lines are ignored); no output means not stored.
+// A non-zero exit status is an error.
+type helperBackend struct {
+	command string
+}
+
+func (helperBackend) Name() string { return "helper" }
+
+func (b helperBackend) Get(service, account string) (string, error) {
+	out, err := b.run("get", service, account, "")
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "secret="); ok {
+			return strings.TrimRight(v, "\r"), nil
+		}
+	}
+	return "", nil
+}
+
+func (b helperBackend) Set(service, account, secret string) error {
+	_, err := b.run("store", service, account, secret)
+	return err
+}
+
+func (b helperBackend) Delete(service, account string) error {
+	_, err := b.run("erase", service, account, "")
+	return err
+}
+
+func (b helperBackend) run(op, service, account, secret string) (string, error) {
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "service=%s\naccount=%s\n", service, account)
+	if secret != "" {
+		fmt.Fprintf(&in, "secret=%s\n", secret)
+	}
+	in.WriteString("\n")
+
+	cmd := exec.Command("sh", "-c", b.command+` "$@"`, "moc-credential-helper", op)
+	cmd.Stdin = &in
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// The helper may ask for a passphrase or report problems itself.
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential helper %q %s: %w", b.command, op, err)
+	}
+	return stdout.String(), nil
+}
@@ -2,44 +2,197 @@ package keystore
 
 import (
 	"errors"
-	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	keyring "github.com/zalando/go-keyring"
 )
 
 const (
 	serviceTargetToken = "multi-oc-target-token"
+	serviceHubToken    = "multi-oc-hub-token"
 )
 
+// GetTargetToken returns the cached token of a cluster from its credential backend, or "" if none.
 func GetTargetToken(clusterName string) (string, error) {
-	// Zuerst Keyring versuchen
-	tok, err := keyring.Get(serviceTargetToken, clusterName)
-	if err == nil && tok != "" {
-		return tok, nil
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return "", err
+	}
+	b, err := BackendFor(clusterName)
+	if err != nil {
+		return "", err
 	}
-	// Datei-Fallback
-	return readTokenFromFile(clusterName)
+	return b.Get(serviceTargetToken, account)
 }
 
+// SetTargetToken stores a cluster token and starts fresh metadata for it (obtained now, not yet validated).
 func SetTargetToken(clusterName, token string) error {
-	// Versuche Keyring
-	if err := keyring.Set(serviceTargetToken, clusterName, token); err == nil {
-		return nil
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return err
+	}
+	b, err := BackendFor(clusterName)
+	if err != nil {
+		return err
+	}
+	if err := b.Set(serviceTargetToken, account, token); err != nil {
+		return err
+	}
+	return SetTargetTokenInfo(clusterName, TokenInfo{ObtainedAt: time.Now().UTC()})
+}
+
+// TargetTokenBackend reports where the token for a cluster is stored: "keyring", "file",
+// "encrypted", the name of an external backend (pass, vault, helper) or "" if none. It never
+// decrypts the token or calls external backends; for those, the token's metadata file counts.
+func TargetTokenBackend(clusterName string) string {
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return ""
+	}
+	b, err := BackendFor(clusterName)
+	if err != nil {
+		return ""
+	}
+	switch b.(type) {
+	case autoBackend, keyringBackend:
+		if tok, err := keyring.Get(serviceTargetToken, account); err == nil && tok != "" {
+			return "keyring"
+		}
+		if _, ok := b.(keyringBackend); ok {
+			return ""
+		}
+	case fileBackend:
+	default:
+		if _, ok, _ := GetTargetTokenInfo(clusterName); ok {
+			return b.Name()
+		}
+		return ""
+	}
+	path, err := secretFilePath(serviceTargetToken, account)
+	if err != nil {
+		return ""
+	}
+	if isEncryptedFile(path) {
+		return "encrypted"
+	}
+	if tok, err := readFile(path); err == nil && tok != "" {
+		return "file"
 	}
-	// Datei-Fallback
-	return writeTokenToFile(clusterName, token)
+	return ""
 }
 
+// ListTargetTokens returns the names of the current hub's clusters with a token file or token
+// metadata, of the user or of the ManagedServiceAccount (see MSAKey). The keyring cannot be
+// enumerated, but every token stored by SetTargetToken has a metadata file.
+func ListTargetTokens() ([]string, error) {
+	id, err := hubScope()
+	if errors.Is(err, ErrNoHub) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	var entries []os.DirEntry
+	for _, sub := range []string{id, filepath.Join(id, strings.TrimSuffix(msaPrefix, "/"))} {
+		e, err := os.ReadDir(filepath.Join(dir, "tokens", sub))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || (ext != ".token" && ext != ".json") {
+			continue
+		}
+		name = strings.TrimSuffix(name, ext)
+		if !seen[name] && ValidateClusterName(name) == nil {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeleteTargetToken removes a cluster's token from its credential backend, together with its
+// metadata and any token file left from the file fallback.
 func DeleteTargetToken(clusterName string) error {
-	_ = keyring.Delete(serviceTargetToken, clusterName)
-	// Datei-Fallback löschen
-	path, err := tokenFilePath(clusterName)
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return err
+	}
+	b, err := BackendFor(clusterName)
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(serviceTargetToken, account); err != nil {
+		return err
+	}
+	if path, err := secretFilePath(serviceTargetToken, account); err == nil {
+		_ = os.Remove(path)
+	}
+	if path, err := tokenInfoFilePath(clusterName); err == nil {
+		_ = os.Remove(path)
+	}
+	return nil
+}
+
+// GetHubToken returns the stored bearer token for the configured hub, or "" if none is stored.
+func GetHubToken() (string, error) {
+	id, err := hubScope()
+	if err != nil {
+		return "", err
+	}
+	b, err := BackendFor("")
+	if err != nil {
+		return "", err
+	}
+	return b.Get(serviceHubToken, id)
+}
+
+// SetHubToken stores the bearer token for the configured hub in the global credential backend.
+func SetHubToken(token string) error {
+	id, err := hubScope()
+	if err != nil {
+		return err
+	}
+	b, err := BackendFor("")
+	if err != nil {
+		return err
+	}
+	return b.Set(serviceHubToken, id, token)
+}
+
+// DeleteHubToken removes the stored token of the configured hub from its credential backend and
+// the file fallback.
+func DeleteHubToken() error {
+	id, err := hubScope()
+	if err != nil {
+		return err
+	}
+	b, err := BackendFor("")
 	if err != nil {
-		return nil
+		return err
+	}
+	if err := b.Delete(serviceHubToken, id); err != nil {
+		return err
+	}
+	if path, err := secretFilePath(serviceHubToken, id); err == nil {
+		_ = os.Remove(path)
 	}
-	_ = os.Remove(path)
 	return nil
 }
 
@@ -55,44 +208,57 @@ func configDir() (string, error) {
 	return filepath.Join(base, "multi-oc"), nil
 }
 
-func tokenFilePath(clusterName string) (string, error) {
+// secretFilePath returns the file of a secret for the file backends:
+// tokens/<hub-id>/<cluster>.token for cluster tokens (account "<hub-id>/<cluster>"; a bare cluster
+// name is the unscoped layout) and hub/<hub-id>.token for hub tokens. Callers validate the names.
+func secretFilePath(service, account string) (string, error) {
 	dir, err := configDir()
 	if err != nil {
 		return "", err
 	}
-	toks := filepath.Join(dir, "tokens")
-	if err := os.MkdirAll(toks, 0o700); err != nil {
+	var path string
+	if service == serviceHubToken {
+		path = filepath.Join(dir, "hub", hubFileName(account)+".token")
+	} else {
+		path = filepath.Join(dir, "tokens", filepath.FromSlash(account)+".token")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return "", err
 	}
-	return filepath.Join(toks, fmt.Sprintf("%s.token", clusterName)), nil
+	return path, nil
+}
+
+// hubFileName returns a hub URL's host with "/" and ":" replaced, for use in file and entry names.
+// Hub IDs are returned unchanged.
+func hubFileName(hubURL string) string {
+	name := hubURL
+	if u, err := url.Parse(hubURL); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	return strings.NewReplacer("/", "_", ":", "_").Replace(name)
 }
 
 // KubeconfigPath returns the default path where a per-cluster kubeconfig
 // can be placed for moc to pick up automatically.
-// Example: ~/.config/multi-oc/kubeconfigs/<cluster>.kubeconfig
+// Example: ~/.config/multi-oc/kubeconfigs/<hub-id>/<cluster>.kubeconfig
 func KubeconfigPath(clusterName string) (string, error) {
-	dir, err := configDir()
-	if err != nil {
+	if err := ValidateClusterName(clusterName); err != nil {
 		return "", err
 	}
-	kcs := filepath.Join(dir, "kubeconfigs")
-	// No mkdir here; reading may not require directory to exist
-	return filepath.Join(kcs, fmt.Sprintf("%s.kubeconfig", clusterName)), nil
-}
-
-func writeTokenToFile(clusterName, token string) error {
-	path, err := tokenFilePath(clusterName)
+	id, err := hubScope()
 	if err != nil {
-		return err
+		return "", err
 	}
-	return os.WriteFile(path, []byte(token+"\n"), 0o600)
-}
-
-func readTokenFromFile(clusterName string) (string, error) {
-	path, err := tokenFilePath(clusterName)
+	dir, err := configDir()
 	if err != nil {
 		return "", err
 	}
+	kcs := filepath.Join(dir, "kubeconfigs", id)
+	// No mkdir here; reading may not require directory to exist
+	return filepath.Join(kcs, clusterName+".kubeconfig"), nil
+}
+
+func readFile(path string) (string, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -0,0 +1,72 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenInfo is the metadata kept next to a cached target-cluster token
+// (~/.config/multi-oc/tokens/<hub-id>/<cluster>.json). It never contains the token itself.
+type TokenInfo struct {
+	ObtainedAt time.Time `json:"obtainedAt"`
+	// ValidatedAt is the last time the cluster accepted the token; zero if never checked.
+	ValidatedAt time.Time `json:"validatedAt"`
+	// ExpiresAt is zero if the expiry is unknown or the token does not expire.
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      string    `json:"user,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+}
+
+// Expired reports whether the token is known to have expired at now.
+func (i TokenInfo) Expired(now time.Time) bool {
+	return !i.ExpiresAt.IsZero() && !now.Before(i.ExpiresAt)
+}
+
+// GetTargetTokenInfo returns the metadata stored for a cluster's token; ok is false if there is none
+// (e.g. for tokens cached before metadata was recorded).
+func GetTargetTokenInfo(clusterName string) (TokenInfo, bool, error) {
+	path, err := tokenInfoFilePath(clusterName)
+	if err != nil {
+		return TokenInfo{}, false, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return TokenInfo{}, false, nil
+		}
+		return TokenInfo{}, false, err
+	}
+	var info TokenInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return TokenInfo{}, false, err
+	}
+	return info, true, nil
+}
+
+// SetTargetTokenInfo stores the metadata for a cluster's token.
+func SetTargetTokenInfo(clusterName string, info TokenInfo) error {
+	path, err := tokenInfoFilePath(clusterName)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+func tokenInfoFilePath(clusterName string) (string, error) {
+	account, err := targetAccount(clusterName)
+	if err != nil {
+		return "", err
+	}
+	path, err := secretFilePath(serviceTargetToken, account)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, ".token") + ".json", nil
+}
@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// passBackend stores secrets in pass(1), the standard unix password manager, as
+// "<MOC_PASS_PREFIX>/tokens/<hub-id>/<cluster>" and "<MOC_PASS_PREFIX>/hub/<hub-id>" (prefix default
+// "multi-oc").
+type passBackend struct{}
+
+func (passBackend) Name() string { return "pass" }
+
+func (passBackend) entry(service, account string) string {
+	prefix := strings.Trim(os.Getenv("MOC_PASS_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "multi-oc"
+	}
+	return prefix + "/" + entryName(service, account)
+}
+
+func (b passBackend) Get(service, account string) (string, error) {
+	out, err := runPass(nil, "show", b.entry(service, account))
+	if err != nil {
+		if strings.Contains(err.Error(), "is not in the password store") {
+			return "", nil
+		}
+		return "", err
+	}
+	line, _, _ := strings.Cut(out, "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+func (b passBackend) Set(service, account, secret string) error {
+	_, err := runPass([]byte(secret+"\n"), "insert", "--multiline", "--force", b.entry(service, account))
+	return err
+}
+
+func (b passBackend) Delete(service, account string) error {
+	_, err := runPass(nil, "rm", "--force", b.entry(service, account))
+	if err != nil && strings.Contains(err.Error(), "is not in the password store") {
+		return nil
+	}
+	return err
+}
+
+func runPass(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("pass", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("pass %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("pass %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
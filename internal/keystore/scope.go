@@ -0,0 +1,207 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"multi-oc/internal/configstate"
+)
+
+// keystoreVersion is the current layout of stored credentials:
+//
+//	1 (implicit): keyring account "<cluster>", tokens/<cluster>.token, kubeconfigs/<cluster>.kubeconfig
+//	2: everything scoped by hub ID: keyring account "<hub-id>/<cluster>",
+//	   tokens/<hub-id>/<cluster>.{token,json}, kubeconfigs/<hub-id>/, hub token keyed by hub ID
+const keystoreVersion = 2
+
+// ErrNoHub is returned when credentials are accessed before a hub has been configured.
+var ErrNoHub = errors.New("no hub configured; run 'moc login --hub <url>'")
+
+// clusterNameRE matches DNS-1123 subdomains, which is what Kubernetes allows for ManagedCluster names.
+var clusterNameRE = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// ValidateClusterName rejects names that are not valid ManagedCluster names. Only valid names are
+// used in file paths and credential keys, so a name like "../x" can never leave its directory.
+func ValidateClusterName(name string) error {
+	if len(name) > 253 || !clusterNameRE.MatchString(name) {
+		return fmt.Errorf("invalid cluster name %q", name)
+	}
+	return nil
+}
+
+var migrateOnce sync.Once
+
+// hubScope returns the ID of the configured hub that all credentials are stored under. The first
+// call of a run migrates credentials stored in the unscoped layout (see migrateLegacy).
+func hubScope() (string, error) {
+	id, err := configstate.HubID()
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", ErrNoHub
+	}
+	migrateOnce.Do(func() {
+		if err := migrateLegacy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: stored credentials not fully migrated (retried next time): %v\n", err)
+		}
+	})
+	return id, nil
+}
+
+// msaPrefix marks the token of moc's ManagedServiceAccount on a cluster (see MSAKey).
+const msaPrefix = "msa/"
+
+// MSAKey returns the name under which the token of moc's ManagedServiceAccount on a cluster is
+// stored, for use in place of the cluster name with the token functions. It is kept apart from
+// the user's own token of the cluster, so that each run uses the identity it asked for.
+func MSAKey(clusterName string) string {
+	return msaPrefix + clusterName
+}
+
+// tokenCluster returns the cluster a token name (a cluster name or MSAKey) belongs to.
+func tokenCluster(name string) string {
+	return strings.TrimPrefix(name, msaPrefix)
+}
+
+// targetAccount returns the key of a cluster's token: "<hub-id>/<cluster>", or
+// "<hub-id>/msa/<cluster>" for MSAKey(cluster).
+func targetAccount(name string) (string, error) {
+	if err := ValidateClusterName(tokenCluster(name)); err != nil {
+		return "", err
+	}
+	id, err := hubScope()
+	if err != nil {
+		return "", err
+	}
+	return id + "/" + name, nil
+}
+
+// migrateLegacy moves the credentials of the original layout, cluster tokens and fetched
+// kubeconfigs, to the hub they were stored for (configstate.LegacyHubID), never to another hub
+// that happens to be active. The keyring cannot be enumerated, so it is probed for every cluster
+// name known locally (see legacyClusterNames); tokens of other clusters are asked for again.
+func migrateLegacy() error {
+	if v, err := configstate.KeystoreVersion(); err != nil || v >= keystoreVersion {
+		return err
+	}
+	id, err := configstate.LegacyHubID()
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		// No hub of an older version, so nothing was stored in the original layout.
+		return configstate.SetKeystoreVersion(keystoreVersion)
+	}
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range legacyClusterNames(dir, id) {
+		if err := migrateToken(dir, id, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	kcs := filepath.Join(dir, "kubeconfigs")
+	files, _ := filepath.Glob(filepath.Join(kcs, "*.kubeconfig"))
+	for _, f := range files {
+		if ValidateClusterName(strings.TrimSuffix(filepath.Base(f), ".kubeconfig")) != nil {
+			continue
+		}
+		if err := renameInto(f, filepath.Join(kcs, id)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return configstate.SetKeystoreVersion(keystoreVersion)
+}
+
+// legacyClusterNames returns the cluster names that may have a token in the original layout:
+// those of token files and kubeconfigs, and those in the discovery cache (the original,
+// unscoped one and that of hub id). Only the names are read from the caches, which every version
+// stores as items[].name.
+func legacyClusterNames(dir, id string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] && ValidateClusterName(name) == nil {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, pattern := range []string{"tokens/*.token", "kubeconfigs/*.kubeconfig"} {
+		files, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		for _, f := range files {
+			add(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)))
+		}
+	}
+	for _, cache := range []string{filepath.Join(dir, "cache", "managedclusters.json"), filepath.Join(dir, "cache", id, "managedclusters.json")} {
+		b, err := os.ReadFile(cache)
+		if err != nil {
+			continue
+		}
+		var cf struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+		}
+		if json.Unmarshal(b, &cf) == nil {
+			for _, it := range cf.Items {
+				add(it.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrateToken moves a cluster's token from the original layout (the keyring, else the token
+// file, keyed by the bare cluster name) to the cluster's credential backend under
+// "<hub-id>/<cluster>". It records empty metadata, so that "moc tokens ls" lists the token.
+func migrateToken(dir, id, name string) error {
+	legacy := autoBackend{}
+	secret, err := legacy.Get(serviceTargetToken, name)
+	if err != nil || secret == "" {
+		return err
+	}
+	b, err := BackendFor(name)
+	if err != nil {
+		return err
+	}
+	if err := b.Set(serviceTargetToken, id+"/"+name, secret); err != nil {
+		return err
+	}
+	meta := filepath.Join(dir, "tokens", id, name+".json")
+	if _, err := os.Stat(meta); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(meta), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(meta, []byte("{}\n"), 0o600); err != nil {
+			return err
+		}
+	}
+	return legacy.Delete(serviceTargetToken, name)
+}
+
+// renameInto moves file into dir (created 0700); a missing file is not an error.
+func renameInto(file, dir string) error {
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.Rename(file, filepath.Join(dir, filepath.Base(file)))
+}
@@ -0,0 +1,160 @@
+package keystore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	keyring "github.com/zalando/go-keyring"
+
+	"multi-oc/internal/configstate"
+)
+
+func TestMigrateLegacy(t *testing.T) {
+	keyring.MockInit()
+	base := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", base)
+	t.Setenv("MOC_HUB", "")
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "")
+	t.Setenv("MOC_TOKEN_ENCRYPTION", "")
+	t.Setenv("MOC_TOKEN_KEY_FILE", "")
+	dir := filepath.Join(base, "multi-oc")
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the original layout: one hub, tokens keyed by the bare cluster name
+	write("state.json", `{"hubURL": "https://api.hub.example:6443"}`)
+	write("cache/managedclusters.json", `{"generatedAt": "2024-01-01T00:00:00Z", "items": [{"name": "c1"}, {"name": "c2"}]}`)
+	write("tokens/c3.token", "sha256~c3\n")
+	write("kubeconfigs/c2.kubeconfig", "apiVersion: v1\n")
+	if err := keyring.Set(serviceTargetToken, "c1", "sha256~c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := configstate.HubID()
+	if err != nil || id != "api.hub.example_6443" {
+		t.Fatalf("HubID = %q, %v", id, err)
+	}
+	if err := migrateLegacy(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"c1": "sha256~c1", "c2": "", "c3": "sha256~c3"} {
+		if got, err := GetTargetToken(name); err != nil || got != want {
+			t.Errorf("GetTargetToken(%s) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := keyring.Get(serviceTargetToken, "c1"); err == nil {
+		t.Error("the keyring entry under the bare cluster name was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tokens", "c3.token")); !os.IsNotExist(err) {
+		t.Error("the legacy token file was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kubeconfigs", id, "c2.kubeconfig")); err != nil {
+		t.Errorf("kubeconfig not moved: %v", err)
+	}
+	names, err := ListTargetTokens()
+	if err != nil || len(names) != 2 || names[0] != "c1" || names[1] != "c3" {
+		t.Errorf("ListTargetTokens = %q, %v", names, err)
+	}
+	if v, err := configstate.KeystoreVersion(); err != nil || v != keystoreVersion {
+		t.Errorf("KeystoreVersion = %d, %v", v, err)
+	}
+}
+
+func TestMigrateLegacyWithOtherHub(t *testing.T) {
+	keyring.MockInit()
+	base := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", base)
+	t.Setenv("MOC_HUB", "")
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "")
+	t.Setenv("MOC_TOKEN_ENCRYPTION", "")
+	t.Setenv("MOC_TOKEN_KEY_FILE", "")
+	dir := filepath.Join(base, "multi-oc")
+	if err := os.MkdirAll(filepath.Join(dir, "kubeconfigs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(`{"hubURL": "https://api.hub.example:6443"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kubeconfigs", "c1.kubeconfig"), []byte("apiVersion: v1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Set(serviceTargetToken, "c1", "sha256~c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first command after the upgrade runs with --hub other
+	if err := configstate.AddHub(configstate.Hub{Name: "other", URL: "https://api.other.example:6443"}); err != nil {
+		t.Fatal(err)
+	}
+	configstate.SetActiveHub("other")
+	t.Cleanup(func() { configstate.SetActiveHub("") })
+	migrateOnce = sync.Once{}
+	if got, err := GetTargetToken("c1"); err != nil || got != "" {
+		t.Errorf("hub other got the legacy token: %q, %v", got, err)
+	}
+	if _, err := keyring.Get(serviceTargetToken, "api.hub.example_6443/c1"); err != nil {
+		t.Errorf("the legacy token was not migrated to the legacy hub: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kubeconfigs", "api.hub.example_6443", "c1.kubeconfig")); err != nil {
+		t.Errorf("kubeconfig not moved to the legacy hub: %v", err)
+	}
+
+	configstate.SetActiveHub("")
+	if got, err := GetTargetToken("c1"); err != nil || got != "sha256~c1" {
+		t.Errorf("GetTargetToken(c1) on the legacy hub = %q, %v", got, err)
+	}
+}
+
+func TestMSATokensKeptApart(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", base)
+	t.Setenv("MOC_HUB", "")
+	t.Setenv("MOC_CREDENTIAL_BACKEND", "file")
+	t.Setenv("MOC_TOKEN_ENCRYPTION", "")
+	if err := configstate.AddHub(configstate.Hub{Name: "test", URL: "https://api.hub.example:6443"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetTargetToken("c1", "sha256~user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTargetToken(MSAKey("c1"), "eyJ.msa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTargetToken(MSAKey("c2"), "eyJ.msa2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetTargetToken("c1"); got != "sha256~user" {
+		t.Errorf("user token = %q", got)
+	}
+	if got, _ := GetTargetToken(MSAKey("c1")); got != "eyJ.msa" {
+		t.Errorf("MSA token = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(base, "multi-oc", "tokens", "api.hub.example_6443", "msa", "c1.token")); err != nil {
+		t.Errorf("MSA token file: %v", err)
+	}
+	names, err := ListTargetTokens()
+	if err != nil || len(names) != 2 || names[0] != "c1" || names[1] != "c2" {
+		t.Errorf("ListTargetTokens = %q, %v", names, err)
+	}
+
+	if err := DeleteTargetToken(MSAKey("c1")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetTargetToken("c1"); got != "sha256~user" {
+		t.Errorf("deleting the MSA token removed the user token: %q", got)
+	}
+	if _, err := GetTargetToken(MSAKey("../c1")); err == nil {
+		t.Error("expected an error for an invalid cluster name")
+	}
+}
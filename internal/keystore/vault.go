@@ -0,0 +1,143 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"multi-oc/internal/kubeapi"
+)
+
+// vaultBackend stores secrets in a HashiCorp Vault KV version 2 engine, at
+// <MOC_VAULT_MOUNT>/data/<MOC_VAULT_PATH>/tokens/<hub-id>/<cluster> (defaults "secret" and
+// "multi-oc") in the field "token"; the hub token is at .../hub/<hub-id>. Address, token, namespace
+// and TLS come from the usual VAULT_* variables.
+type vaultBackend struct{}
+
+func (vaultBackend) Name() string { return "vault" }
+
+func (b vaultBackend) Get(service, account string) (string, error) {
+	var out struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	found, err := b.do(http.MethodGet, "data", service, account, nil, &out)
+	if err != nil || !found {
+		return "", err
+	}
+	return out.Data.Data["token"], nil
+}
+
+func (b vaultBackend) Set(service, account, secret string) error {
+	body := map[string]any{"data": map[string]string{"token": secret}}
+	_, err := b.do(http.MethodPost, "data", service, account, body, nil)
+	return err
+}
+
+// Delete removes the secret with all its versions.
+func (b vaultBackend) Delete(service, account string) error {
+	_, err := b.do(http.MethodDelete, "metadata", service, account, nil, nil)
+	return err
+}
+
+// do sends a request to the KV v2 API; found is false for 404 (no such secret).
+func (vaultBackend) do(method, kind, service, account string, body, out any) (found bool, err error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return false, fmt.Errorf("credential backend vault: VAULT_ADDR is not set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return false, err
+	}
+	mount := strings.Trim(os.Getenv("MOC_VAULT_MOUNT"), "/")
+	if mount == "" {
+		mount = "secret"
+	}
+	prefix := strings.Trim(os.Getenv("MOC_VAULT_PATH"), "/")
+	if prefix == "" {
+		prefix = "multi-oc"
+	}
+	client, err := kubeapi.NewHTTPClient(kubeapi.Config{
+		CAFile:      os.Getenv("VAULT_CACERT"),
+		Insecure:    os.Getenv("VAULT_SKIP_VERIFY") == "true" || os.Getenv("VAULT_SKIP_VERIFY") == "1",
+		SystemRoots: true,
+		Timeout:     15 * time.Second,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return false, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	u := addr + "/v1/" + mount + "/" + kind + "/" + prefix + "/" + entryName(service, account)
+	req, err := http.NewRequestWithContext(context.Background(), method, u, rd)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 300:
+		var ve struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &ve)
+		if len(ve.Errors) > 0 {
+			return false, fmt.Errorf("vault: %s: %s", resp.Status, strings.Join(ve.Errors, "; "))
+		}
+		return false, fmt.Errorf("vault: %s", resp.Status)
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return false, fmt.Errorf("vault: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// vaultToken returns VAULT_TOKEN or the token "vault login" stored in ~/.vault-token.
+func vaultToken() (string, error) {
+	if t := strings.TrimSpace(os.Getenv("VAULT_TOKEN")); t != "" {
+		return t, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	t, err := readFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", err
+	}
+	if t = strings.TrimSpace(t); t == "" {
+		return "", fmt.Errorf("credential backend vault: no VAULT_TOKEN and no ~/.vault-token (run 'vault login')")
+	}
+	return t, nil
+}
@@ -0,0 +1,305 @@
+package kubeapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// pageSize is the number of items requested per page in List.
+const pageSize = 500
+
+// Config describes how to reach a Kubernetes API server.
+type Config struct {
+	Server   string
+	Token    string
+	CAData   []byte
+	CAFile   string
+	Insecure bool
+	Timeout  time.Duration
+	// Proxy is an HTTP(S) proxy URL; without it the proxy environment variables apply.
+	Proxy string
+	// SystemRoots trusts the system roots in addition to CAData/CAFile, e.g. for the OAuth server,
+	// which is served by the ingress and often has a different certificate than the API server.
+	SystemRoots bool
+}
+
+// Client is a minimal Kubernetes API client using bearer-token authentication.
+type Client struct {
+	Server string
+	Token  string
+	HTTP   *http.Client
+}
+
+// New creates a client from cfg. Without CAData, CAFile or Insecure the system roots are used.
+func New(cfg Config) (*Client, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("API server URL is empty")
+	}
+	httpClient, err := NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Server: strings.TrimSuffix(cfg.Server, "/"),
+		Token:  cfg.Token,
+		HTTP:   httpClient,
+	}, nil
+}
+
+// NewHTTPClient returns an HTTP client that verifies TLS as described by cfg (Server and Token are ignored).
+func NewHTTPClient(cfg Config) (*http.Client, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case cfg.Insecure:
+		tlsCfg.InsecureSkipVerify = true
+	case len(cfg.CAData) > 0 || cfg.CAFile != "":
+		pem := cfg.CAData
+		if cfg.CAFile != "" {
+			b, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pem = b
+		}
+		pool := x509.NewCertPool()
+		if cfg.SystemRoots {
+			if sys, err := x509.SystemCertPool(); err == nil {
+				pool = sys
+			}
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid CA certificates found")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// Get fetches path and decodes the JSON response into out.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.Do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// Do sends a request with an optional JSON body and decodes the JSON response into out (if non-nil).
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return classifyTransportError(method, u, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &Error{Kind: KindNetwork, Method: method, URL: u, Err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(method, u, resp.StatusCode, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Probe checks that an API server answers at cfg.Server. Any HTTP response counts, including
+// 401/403, so no token is needed; unreachable servers and failed TLS verification are errors.
+func Probe(ctx context.Context, cfg Config) error {
+	cfg.Token = ""
+	client, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	err = client.Get(ctx, "/version", nil, nil)
+	var apiErr *Error
+	if err == nil || (errors.As(err, &apiErr) && apiErr.StatusCode != 0) {
+		return nil
+	}
+	return err
+}
+
+// List fetches all items of a collection, following "continue" tokens page by page.
+func (c *Client) List(ctx context.Context, path string, query url.Values) ([]json.RawMessage, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("limit", fmt.Sprint(pageSize))
+	var items []json.RawMessage
+	for {
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := c.Get(ctx, path, q, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.Metadata.Continue == "" {
+			return items, nil
+		}
+		q.Set("continue", page.Metadata.Continue)
+	}
+}
+
+// DecodeItems decodes raw list items (as returned by List) into out, which must point to a slice.
+func DecodeItems(items []json.RawMessage, out any) error {
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// ErrorKind classifies API errors so callers can decide whether to re-login, report or retry.
+type ErrorKind int
+
+const (
+	KindOther ErrorKind = iota
+	KindNetwork
+	KindTLS
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+)
+
+// Error is returned for failed API calls.
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int
+	Method     string
+	URL        string
+	Message    string
+	// Object is the name of the object a 404 reports as missing (the Status details); it is empty
+	// if the resource itself is not served.
+	Object string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case KindNetwork:
+		return fmt.Sprintf("%s not reachable: %v", hostOf(e.URL), e.Err)
+	case KindTLS:
+		return fmt.Sprintf("TLS verification for %s failed (provide a CA file or use --insecure): %v", hostOf(e.URL), e.Err)
+	case KindUnauthorized:
+		return fmt.Sprintf("unauthorized (401) at %s: token missing, invalid or expired", hostOf(e.URL))
+	case KindForbidden:
+		return fmt.Sprintf("forbidden (403): %s", e.Message)
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Message)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s: %v", e.Method, e.URL, e.Err)
+	}
+	return fmt.Sprintf("%s %s: HTTP %d", e.Method, e.URL, e.StatusCode)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// IsUnauthorized reports whether err is a 401 from the API server.
+func IsUnauthorized(err error) bool { return isKind(err, KindUnauthorized) }
+
+// IsForbidden reports whether err is a 403 from the API server.
+func IsForbidden(err error) bool { return isKind(err, KindForbidden) }
+
+// IsNotFound reports whether err is a 404 from the API server.
+func IsNotFound(err error) bool { return isKind(err, KindNotFound) }
+
+// IsNetwork reports whether the API server could not be reached at all.
+func IsNetwork(err error) bool { return isKind(err, KindNetwork) }
+
+func isKind(err error, k ErrorKind) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == k
+}
+
+func statusError(method, u string, code int, body []byte) error {
+	var st struct {
+		Message string `json:"message"`
+		Details struct {
+			Name string `json:"name"`
+		} `json:"details"`
+	}
+	_ = json.Unmarshal(body, &st)
+	e := &Error{StatusCode: code, Method: method, URL: u, Message: st.Message, Object: st.Details.Name}
+	switch code {
+	case http.StatusUnauthorized:
+		e.Kind = KindUnauthorized
+	case http.StatusForbidden:
+		e.Kind = KindForbidden
+	case http.StatusNotFound:
+		e.Kind = KindNotFound
+	default:
+		e.Kind = KindOther
+	}
+	return e
+}
+
+func classifyTransportError(method, u string, err error) error {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuth) || errors.As(err, &hostErr) {
+		return &Error{Kind: KindTLS, Method: method, URL: u, Err: err}
+	}
+	return &Error{Kind: KindNetwork, Method: method, URL: u, Err: err}
+}
+
+func hostOf(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return raw
+}
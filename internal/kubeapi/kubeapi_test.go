@@ -0,0 +1,201 @@
+package kubeapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	c, err := New(Config{Server: srv.URL, Token: "sha256~test", Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestListPagination(t *testing.T) {
+	var pages []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sha256~test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		q := r.URL.Query()
+		if q.Get("limit") != fmt.Sprint(pageSize) || q.Get("labelSelector") != "env=prod" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		pages = append(pages, q.Get("continue"))
+		switch q.Get("continue") {
+		case "":
+			fmt.Fprint(w, `{"metadata":{"continue":"p2"},"items":[{"metadata":{"name":"c1"}},{"metadata":{"name":"c2"}}]}`)
+		case "p2":
+			fmt.Fprint(w, `{"metadata":{},"items":[{"metadata":{"name":"c3"}}]}`)
+		default:
+			t.Errorf("unexpected continue token %q", q.Get("continue"))
+		}
+	}))
+
+	items, err := c.List(context.Background(), "/apis/cluster.open-cluster-management.io/v1/managedclusters",
+		map[string][]string{"labelSelector": {"env=prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[1] != "p2" {
+		t.Errorf("pages requested: %q", pages)
+	}
+	var got []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := DecodeItems(items, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Metadata.Name != "c1" || got[2].Metadata.Name != "c3" {
+		t.Errorf("items = %+v", got)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		code int
+		is   func(error) bool
+		kind ErrorKind
+	}{
+		{http.StatusUnauthorized, IsUnauthorized, KindUnauthorized},
+		{http.StatusForbidden, IsForbidden, KindForbidden},
+		{http.StatusNotFound, IsNotFound, KindNotFound},
+		{http.StatusInternalServerError, nil, KindOther},
+	}
+	for _, tt := range tests {
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+			_ = json.NewEncoder(w).Encode(map[string]string{"kind": "Status", "message": "denied by test"})
+		}))
+		err := c.Get(context.Background(), "/api/v1/namespaces", nil, nil)
+		apiErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("HTTP %d: got %T %v", tt.code, err, err)
+		}
+		if apiErr.Kind != tt.kind || apiErr.StatusCode != tt.code || apiErr.Message != "denied by test" {
+			t.Errorf("HTTP %d: got %+v", tt.code, apiErr)
+		}
+		if tt.is != nil && !tt.is(err) {
+			t.Errorf("HTTP %d: not classified as expected: %v", tt.code, err)
+		}
+		if IsNetwork(err) {
+			t.Errorf("HTTP %d classified as a network error", tt.code)
+		}
+	}
+}
+
+func TestNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	c, err := New(Config{Server: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Get(context.Background(), "/version", nil, nil)
+	if !IsNetwork(err) {
+		t.Errorf("expected a network error, got %v", err)
+	}
+	if err := Probe(context.Background(), Config{Server: url}); !IsNetwork(err) {
+		t.Errorf("Probe: expected a network error, got %v", err)
+	}
+}
+
+func TestTLSError(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	c, err := New(Config{Server: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Get(context.Background(), "/version", nil, nil)
+	if !isKind(err, KindTLS) {
+		t.Errorf("expected a TLS error, got %v", err)
+	}
+}
+
+func TestProbeAcceptsUnauthorized(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Probe must not send a token")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	if err := Probe(context.Background(), Config{Server: srv.URL, Token: "secret", Insecure: true}); err != nil {
+		t.Errorf("Probe: %v", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	const token = "sha256~secret"
+	name := OAuthTokenName(token)
+	gone := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"kind":"Status","reason":"NotFound","details":{"name":%q}}`, name)
+	}
+	notServed := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"kind":"Status","reason":"NotFound","message":"the server could not find the requested resource"}`)
+	}
+	tests := []struct {
+		name          string
+		user, cluster func(http.ResponseWriter)
+		wantErr       func(error) bool
+		requests      int
+	}{
+		{"deleted", func(w http.ResponseWriter) {}, nil, nil, 1},
+		{"already gone", gone, nil, nil, 1},
+		{"owner API forbidden", func(w http.ResponseWriter) { w.WriteHeader(http.StatusForbidden) }, func(w http.ResponseWriter) {}, nil, 2},
+		{"owner API not served", notServed, gone, nil, 2},
+		{"not served, then forbidden", notServed, func(w http.ResponseWriter) { w.WriteHeader(http.StatusForbidden) }, IsForbidden, 2},
+		{"neither API served", notServed, notServed, IsNotFound, 2},
+	}
+	for _, tt := range tests {
+		var requests int
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			switch r.URL.Path {
+			case "/apis/oauth.openshift.io/v1/useroauthaccesstokens/" + name:
+				tt.user(w)
+			case "/apis/oauth.openshift.io/v1/oauthaccesstokens/" + name:
+				tt.cluster(w)
+			default:
+				t.Errorf("%s: unexpected %s %s", tt.name, r.Method, r.URL.Path)
+			}
+		}))
+		c.Token = token
+		err := c.RevokeToken(context.Background())
+		switch {
+		case tt.wantErr == nil && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != nil && !tt.wantErr(err):
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if requests != tt.requests {
+			t.Errorf("%s: %d requests, want %d", tt.name, requests, tt.requests)
+		}
+	}
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("a JWT must not be sent to the OAuth API: %s %s", r.Method, r.URL.Path)
+	}))
+	c.Token = "eyJhbGciOiJSUzI1NiJ9.e30.sig"
+	if Revocable(c.Token) {
+		t.Error("a JWT is not revocable")
+	}
+	if err := c.RevokeToken(context.Background()); err != nil {
+		t.Errorf("JWT: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package kubeapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Identity describes the user behind a bearer token.
+type Identity struct {
+	User   string
+	Groups []string
+	// ExpiresAt is zero if the expiry is unknown or the token never expires.
+	ExpiresAt time.Time
+}
+
+// OAuthTokenName returns the name of the UserOAuthAccessToken object for an OpenShift OAuth token:
+// "sha256~" + base64url(sha256(<token without its "sha256~" prefix>)).
+func OAuthTokenName(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(token, "sha256~")))
+	return "sha256~" + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Identity returns the user and groups the client's token authenticates as (users/~) and,
+// where it can be determined, when the token expires. An error from users/~ means the token
+// could not be validated; failing to read the expiry is not an error.
+func (c *Client) Identity(ctx context.Context) (Identity, error) {
+	var user struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Groups []string `json:"groups"`
+	}
+	if err := c.Get(ctx, "/apis/user.openshift.io/v1/users/~", nil, &user); err != nil {
+		return Identity{}, err
+	}
+	id := Identity{User: user.Metadata.Name, Groups: user.Groups}
+	id.ExpiresAt, _ = c.TokenExpiry(ctx)
+	return id, nil
+}
+
+// TokenExpiry returns when the client's token expires. OAuth tokens (sha256~...) are looked up in
+// the useroauthaccesstokens API (readable by their owner); for service account tokens (JWTs) the
+// "exp" claim is used. A zero time means the token does not expire.
+func (c *Client) TokenExpiry(ctx context.Context) (time.Time, error) {
+	if !strings.HasPrefix(c.Token, "sha256~") {
+		return jwtExpiry(c.Token)
+	}
+	var tok struct {
+		Metadata struct {
+			CreationTimestamp time.Time `json:"creationTimestamp"`
+		} `json:"metadata"`
+		ExpiresIn int64 `json:"expiresIn"`
+	}
+	path := "/apis/oauth.openshift.io/v1/useroauthaccesstokens/" + url.PathEscape(OAuthTokenName(c.Token))
+	if err := c.Get(ctx, path, nil, &tok); err != nil {
+		return time.Time{}, err
+	}
+	if tok.ExpiresIn <= 0 {
+		return time.Time{}, nil
+	}
+	return tok.Metadata.CreationTimestamp.Add(time.Duration(tok.ExpiresIn) * time.Second), nil
+}
+
+// Revocable reports whether token is an OAuth access token that RevokeToken can delete on the server.
+func Revocable(token string) bool {
+	return strings.HasPrefix(token, "sha256~")
+}
+
+// RevokeToken deletes the client's OAuth access token on the server so it can no longer be used.
+// The owner's useroauthaccesstokens API is tried first, then oauthaccesstokens (clusters before
+// OpenShift 4.6, where the former is not served, or admins). A token whose object no longer
+// exists counts as revoked; a 404 because an API is not served does not. Service account tokens
+// (JWTs) cannot be revoked this way; for them nothing is done. A token the server no longer
+// accepts (401) is already unusable and counts as revoked as well.
+func (c *Client) RevokeToken(ctx context.Context) error {
+	if !Revocable(c.Token) {
+		return nil
+	}
+	name := OAuthTokenName(c.Token)
+	err := c.Do(ctx, http.MethodDelete, "/apis/oauth.openshift.io/v1/useroauthaccesstokens/"+url.PathEscape(name), nil, nil, nil)
+	if err == nil || IsUnauthorized(err) || objectGone(err, name) {
+		return nil
+	}
+	if !IsNotFound(err) && !IsForbidden(err) {
+		return err
+	}
+	err2 := c.Do(ctx, http.MethodDelete, "/apis/oauth.openshift.io/v1/oauthaccesstokens/"+url.PathEscape(name), nil, nil, nil)
+	if err2 == nil || IsUnauthorized(err2) || objectGone(err2, name) {
+		return nil
+	}
+	if IsNotFound(err) {
+		// useroauthaccesstokens is not served, so oauthaccesstokens is what tells why.
+		return err2
+	}
+	return err
+}
+
+// objectGone reports whether err is a 404 for the object name itself, as opposed to one for an
+// API that is not served.
+func objectGone(err error, name string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == KindNotFound && e.Object == name
+}
+
+// jwtExpiry reads the "exp" claim of a JWT without verifying its signature.
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("token is neither an OAuth token nor a JWT")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
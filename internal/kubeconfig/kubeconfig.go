@@ -0,0 +1,144 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds what oc needs to talk to one API server with a bearer token.
+type Config struct {
+	Server    string
+	Token     string
+	CAData    []byte
+	CAFile    string
+	Insecure  bool
+	ProxyURL  string
+	Namespace string
+}
+
+type file struct {
+	APIVersion     string          `json:"apiVersion"`
+	Kind           string          `json:"kind"`
+	Clusters       []namedCluster  `json:"clusters"`
+	Users          []namedUser     `json:"users"`
+	Contexts       []namedContext  `json:"contexts"`
+	CurrentContext string          `json:"current-context"`
+	Preferences    json.RawMessage `json:"preferences"`
+}
+
+type namedCluster struct {
+	Name    string `json:"name"`
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthority     string `json:"certificate-authority,omitempty"`
+		CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+		InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+		ProxyURL                 string `json:"proxy-url,omitempty"`
+	} `json:"cluster"`
+}
+
+type namedUser struct {
+	Name string `json:"name"`
+	User struct {
+		Token string `json:"token,omitempty"`
+	} `json:"user"`
+}
+
+type namedContext struct {
+	Name    string `json:"name"`
+	Context struct {
+		Cluster   string `json:"cluster"`
+		User      string `json:"user"`
+		Namespace string `json:"namespace,omitempty"`
+	} `json:"context"`
+}
+
+// Write writes a single-context kubeconfig (JSON, which oc accepts) to path with mode 0600.
+// An existing file is replaced.
+func Write(path string, cfg Config) error {
+	if cfg.Server == "" {
+		return fmt.Errorf("kubeconfig: server is empty")
+	}
+	var c namedCluster
+	c.Name = "moc"
+	c.Cluster.Server = cfg.Server
+	c.Cluster.ProxyURL = cfg.ProxyURL
+	switch {
+	case cfg.CAFile != "":
+		// oc resolves relative paths against the kubeconfig's directory, not the working directory
+		ca, err := filepath.Abs(cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		c.Cluster.CertificateAuthority = ca
+	case len(cfg.CAData) > 0:
+		c.Cluster.CertificateAuthorityData = cfg.CAData
+	case cfg.Insecure:
+		c.Cluster.InsecureSkipTLSVerify = true
+	}
+	var u namedUser
+	u.Name = "moc"
+	u.User.Token = cfg.Token
+	var x namedContext
+	x.Name = "moc"
+	x.Context.Cluster = c.Name
+	x.Context.User = u.Name
+	x.Context.Namespace = cfg.Namespace
+
+	b, err := json.MarshalIndent(file{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []namedCluster{c},
+		Users:          []namedUser{u},
+		Contexts:       []namedContext{x},
+		CurrentContext: x.Name,
+		Preferences:    json.RawMessage("{}"),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write to a private temp file first so the token is never readable by others, then rename.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".kubeconfig-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteTemp writes cfg into a new private directory (0700) and returns the kubeconfig path and a
+// cleanup function that removes the directory. $XDG_RUNTIME_DIR (a per-user tmpfs) is preferred.
+func WriteTemp(cfg Config) (string, func(), error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if st, err := os.Stat(base); base == "" || err != nil || !st.IsDir() {
+		base = ""
+	}
+	dir, err := os.MkdirTemp(base, "moc-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	path := filepath.Join(dir, "kubeconfig")
+	if err := Write(path, cfg); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
@@ -0,0 +1,93 @@
+package kubeexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/kubeapi"
+)
+
+// probeTimeout bounds the reachability check of one cluster API URL.
+const probeTimeout = 5 * time.Second
+
+// SelectEndpoint chooses the API URL of cluster c among its managedClusterClientConfigs and
+// returns c with that endpoint in use.
+//
+//	opts.APIURLIndex 1          → always the second URL, without probing
+//	opts.APIURLPrefer regexp    → try URLs matching the expression first
+//	apiURL in config.yaml       → always that URL, without probing
+//
+// Otherwise the URL that worked last is tried first, then the others in the hub's order; the
+// first one that answers is used and remembered. A cluster with a single URL, or reached through
+// a kubeconfig of its own, is not probed.
+func SelectEndpoint(ctx context.Context, c discovery.Cluster, opts Options) (discovery.Cluster, error) {
+	if findKubeconfigForCluster(c.Name) != "" {
+		return c, nil
+	}
+	if i := opts.APIURLIndex; i >= 0 {
+		if i >= len(c.Endpoints) {
+			return c, fmt.Errorf("cluster %s has %d API URL(s), --api-url-index %d is out of range", c.Name, len(c.Endpoints), i)
+		}
+		return c.WithEndpoint(c.Endpoints[i]), nil
+	}
+	if u := targetSettings(c).APIURL; u != "" && opts.APIURLPrefer == nil {
+		for _, e := range c.Endpoints {
+			if e.URL == u {
+				return c.WithEndpoint(e), nil
+			}
+		}
+		// Not advertised by the hub: keep the CA bundle of the endpoint in use
+		return c.WithEndpoint(discovery.Endpoint{URL: u, CAData: c.CAData}), nil
+	}
+	candidates := endpointOrder(c, opts.APIURLPrefer)
+	if len(candidates) <= 1 {
+		if len(candidates) == 1 {
+			c = c.WithEndpoint(candidates[0])
+		}
+		return c, nil
+	}
+	var errs []error
+	for _, e := range candidates {
+		probe := TargetConfig(c.WithEndpoint(e), "")
+		probe.Timeout = probeTimeout
+		if err := kubeapi.Probe(ctx, probe); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if e.URL != candidates[0].URL {
+			fmt.Fprintf(os.Stderr, "%s: API URL %s not reachable, using %s\n", c.Name, candidates[0].URL, e.URL)
+		}
+		_ = discovery.RememberEndpoint(c.Name, e.URL)
+		return c.WithEndpoint(e), nil
+	}
+	return c, fmt.Errorf("no API URL of cluster %s is reachable: %w", c.Name, errors.Join(errs...))
+}
+
+// endpointOrder returns the endpoints of c in the order they are tried: those matching prefer,
+// the one that worked last, then the rest as listed on the hub.
+func endpointOrder(c discovery.Cluster, prefer *regexp.Regexp) []discovery.Endpoint {
+	last := discovery.RememberedEndpoint(c.Name)
+	rank := func(e discovery.Endpoint) int {
+		switch {
+		case prefer != nil && prefer.MatchString(e.URL):
+			return 0
+		case e.URL == last:
+			return 1
+		}
+		return 2
+	}
+	var ordered []discovery.Endpoint
+	for r := 0; r <= 2; r++ {
+		for _, e := range c.Endpoints {
+			if rank(e) == r {
+				ordered = append(ordered, e)
+			}
+		}
+	}
+	return ordered
+}
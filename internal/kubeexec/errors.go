@@ -0,0 +1,47 @@
+package kubeexec
+
+import (
+	"bytes"
+	"os"
+
+	"multi-oc/internal/discovery"
+)
+
+// authFailureMarkers are the messages oc prints when the API server answers 401.
+// Other failures (NotFound, Forbidden, validation errors, ...) must not be treated as auth failures.
+var authFailureMarkers = [][]byte{
+	[]byte("You must be logged in to the server (Unauthorized)"),
+	[]byte("the server has asked for the client to provide credentials"),
+}
+
+// readOnlyVerbs are the oc commands that only read from the cluster.
+var readOnlyVerbs = map[string]bool{
+	"api-resources": true, "api-versions": true, "cluster-info": true, "describe": true, "events": true,
+	"explain": true, "get": true, "logs": true, "projects": true, "status": true, "top": true,
+	"version": true, "whoami": true,
+}
+
+// IsAuthFailure reports whether oc's stderr shows that the token was rejected (HTTP 401).
+// The rejected request itself was not processed, but see RetrySafe for the command as a whole.
+func IsAuthFailure(stderr []byte) bool {
+	for _, m := range authFailureMarkers {
+		if bytes.Contains(stderr, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetrySafe reports whether an oc command that failed with 401 may be run again as it is. A command
+// making several requests (apply -f dir/, delete a b c, rollout restart ...) may have changed some
+// objects before the request that was rejected, so only read-only commands are re-run, and only if
+// the first run could not have consumed stdin (readsStdin: it is not a terminal).
+func RetrySafe(ocArgs []string, readsStdin bool) bool {
+	return len(ocArgs) > 0 && readOnlyVerbs[ocArgs[0]] && !readsStdin
+}
+
+// CanRefreshToken reports whether a rejected token for c can be replaced by prompting again,
+// i.e. the credentials come from the keystore rather than a kubeconfig or MOC_TARGET_TOKEN.
+func CanRefreshToken(c discovery.Cluster) bool {
+	return findKubeconfigForCluster(c.Name) == "" && sanitizeToken(os.Getenv("MOC_TARGET_TOKEN")) == ""
+}
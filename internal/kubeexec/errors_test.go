@@ -0,0 +1,33 @@
+package kubeexec
+
+import "testing"
+
+func TestRetrySafe(t *testing.T) {
+	tests := []struct {
+		args       []string
+		readsStdin bool
+		want       bool
+	}{
+		{[]string{"get", "pods", "-A"}, false, true},
+		{[]string{"logs", "deploy/web"}, false, true},
+		{[]string{"get", "-f", "-"}, true, false},
+		{[]string{"apply", "-f", "manifests/"}, false, false},
+		{[]string{"delete", "pod", "a", "b", "c"}, false, false},
+		{[]string{"rollout", "restart", "deploy"}, false, false},
+		{nil, false, false},
+	}
+	for _, tt := range tests {
+		if got := RetrySafe(tt.args, tt.readsStdin); got != tt.want {
+			t.Errorf("RetrySafe(%q, %v) = %v, want %v", tt.args, tt.readsStdin, got, tt.want)
+		}
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	if !IsAuthFailure([]byte("error: You must be logged in to the server (Unauthorized)\n")) {
+		t.Error("401 not detected")
+	}
+	if IsAuthFailure([]byte(`Error from server (Forbidden): pods is forbidden`)) {
+		t.Error("403 taken for a 401")
+	}
+}
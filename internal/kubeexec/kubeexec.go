@@ -1,86 +1,150 @@
 package kubeexec
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 
 	"multi-oc/internal/discovery"
 	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+	"multi-oc/internal/kubeconfig"
+	"multi-oc/internal/msa"
+	"multi-oc/internal/oauth"
+	"multi-oc/internal/prompt"
 )
 
-// BuildOcAuthArgs builds authentication args for "oc" (without kubeconfig):
-// --server, --token, and optionally --certificate-authority or --insecure-skip-tls-verify.
-// Sources: Env (MOC_TARGET_TOKEN/CA_FILE/INSECURE) -> Keyring -> interactive prompt.
-// Returns a cleanup function (removes temporary CA file if created).
-func BuildOcAuthArgs(ctx context.Context, c discovery.Cluster) ([]string, func(), error) {
-	_ = ctx
+// BuildOcAuthArgs builds authentication args for "oc": always a single --kubeconfig.
+// Without an existing kubeconfig, a temporary one holding server, token and TLS settings is written.
+// Sources: Env (MOC_TARGET_TOKEN/CA_FILE/INSECURE) -> Keyring (the user's or the MSA token, as
+// chosen by opts.Auth) -> new token as chosen by opts; TLS,
+// proxy and default namespace may also come from config.yaml.
+// Returns a cleanup function (removes the temporary kubeconfig if created).
+func BuildOcAuthArgs(ctx context.Context, c discovery.Cluster, opts Options) ([]string, func(), error) {
 	if c.APIURL == "" {
 		return nil, nil, fmt.Errorf("APIURL empty")
 	}
-	cleanup := func() {}
-
 	// 0) Prefer existing kubeconfig (env or per-cluster path)
 	if p := findKubeconfigForCluster(c.Name); p != "" {
-		return []string{"--kubeconfig", p}, cleanup, nil
+		return []string{"--kubeconfig", p}, func() {}, nil
 	}
 
-	// 1) Token from env -> Keyring -> prompt
+	// 1) Token from env -> Keyring (if not expired or rejected) -> prompt
 	token := sanitizeToken(os.Getenv("MOC_TARGET_TOKEN"))
 	if token == "" {
-		if t, err := keystore.GetTargetToken(c.Name); err == nil && t != "" {
-			token = sanitizeToken(t)
+		var err error
+		if token, err = cachedToken(ctx, c, TokenKey(c.Name, opts.Auth)); err != nil {
+			return nil, nil, err
 		}
 	}
 	if token == "" {
-		// Hint URL for token retrieval
-		hint := deriveOAuthTokenURL(c.APIURL)
-		if hint != "" {
-			fmt.Fprintf(os.Stderr, "No token found. Open in a browser (from any machine with access):\n  %s\nSign in there, copy the token (starting with 'sha256~') and paste it here.\n", hint)
-		} else {
-			fmt.Fprintln(os.Stderr, "No token found. Please get your 'oc login --token' from the OpenShift Web Console and paste it here (sha256~...).")
-		}
-		fmt.Fprint(os.Stderr, "Token: ")
-		stdin := bufio.NewReader(os.Stdin)
-		line, _ := stdin.ReadString('\n')
-		token = sanitizeToken(line)
-		if token == "" {
-			return nil, nil, fmt.Errorf("no valid token detected")
+		var err error
+		if token, err = PromptToken(ctx, c, opts); err != nil {
+			return nil, nil, err
 		}
-		_ = keystore.SetTargetToken(c.Name, token)
 	}
 
-	// 2) Determine TLS flags
-	insecure := os.Getenv("MOC_TARGET_INSECURE") == "true"
-	caFile := os.Getenv("MOC_TARGET_CA_FILE")
-
-	args := []string{"--server", c.APIURL, "--token", token}
+	// 2) Hand the token to oc through an ephemeral 0600 kubeconfig, never on argv
+	// (argv is world-readable via ps and /proc/<pid>/cmdline).
+	cfg := TargetConfig(c, token)
+	if cfg.CAFile != "" {
+		// config.yaml is loaded without checking files, so that a missing one only fails its clusters.
+		if _, err := os.Stat(cfg.CAFile); err != nil {
+			return nil, nil, fmt.Errorf("CA file for cluster %s: %w", c.Name, err)
+		}
+	}
+	path, cleanup, err := kubeconfig.WriteTemp(kubeconfig.Config{
+		Server:    cfg.Server,
+		Token:     cfg.Token,
+		CAData:    cfg.CAData,
+		CAFile:    cfg.CAFile,
+		Insecure:  cfg.Insecure,
+		ProxyURL:  cfg.Proxy,
+		Namespace: targetSettings(c).Namespace,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"--kubeconfig", path}, cleanup, nil
+}
 
-	if caFile != "" {
-		args = append(args, "--certificate-authority", caFile)
-	} else if len(c.CAData) > 0 {
-		// Write CA to a temporary file
-		tmpDir, err := os.MkdirTemp("", "moc-ca-*")
+// PromptToken obtains a new token for cluster c, then stores and checks it. With opts.Auth AuthMSA
+// the token comes from the cluster's ManagedServiceAccount on the hub, without any prompt. Otherwise,
+// with opts.Username it logs in with username and password, else it opens a browser login if
+// possible. If neither works it asks for a token to be pasted (printing where to get one).
+func PromptToken(ctx context.Context, c discovery.Cluster, opts Options) (string, error) {
+	switch opts.Auth {
+	case AuthMSA:
+		token, err := msa.Token(ctx, c.Name)
 		if err != nil {
-			return nil, nil, err
+			return "", err
 		}
-		caPath := filepath.Join(tmpDir, "ca.crt")
-		if err := os.WriteFile(caPath, c.CAData, 0o600); err != nil {
-			_ = os.RemoveAll(tmpDir)
-			return nil, nil, err
+		return StoreToken(ctx, c, keystore.MSAKey(c.Name), token)
+	case AuthUser, "":
+	default:
+		return "", fmt.Errorf("unknown credential source %q (expected %s or %s)", opts.Auth, AuthUser, AuthMSA)
+	}
+	if user := opts.Username; user != "" {
+		token, err := passwordLogin(ctx, c, user, opts.ReusePassword)
+		if err == nil {
+			return StoreToken(ctx, c, c.Name, token)
 		}
-		cleanup = func() { _ = os.RemoveAll(tmpDir) }
-		args = append(args, "--certificate-authority", caPath)
-	} else if insecure {
-		args = append(args, "--insecure-skip-tls-verify=true")
+		if errors.Is(err, oauth.ErrBadCredentials) {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "Password login to %s not possible: %v\n", c.Name, err)
+	} else if oauth.BrowserAvailable(ctx) {
+		tok, err := oauth.BrowserToken(ctx, TargetConfig(c, ""))
+		if err == nil {
+			return StoreToken(ctx, c, c.Name, tok.AccessToken)
+		}
+		fmt.Fprintf(os.Stderr, "Browser login to %s failed: %v\n", c.Name, err)
+	}
+	// Hint URL for token retrieval
+	hint := deriveOAuthTokenURL(c.APIURL)
+	if hint != "" {
+		fmt.Fprintf(os.Stderr, "No token found. Open in a browser (from any machine with access):\n  %s\nSign in there, copy the token (starting with 'sha256~') and paste it here.\n", hint)
+	} else {
+		fmt.Fprintln(os.Stderr, "No token found. Please get your 'oc login --token' from the OpenShift Web Console and paste it here (sha256~...).")
+	}
+	return StoreToken(ctx, c, c.Name, prompt.Line("Token: "))
+}
+
+// StoreToken extracts a token from input (bare "sha256~..." or a line like "oc login --token=..."),
+// checks it against cluster c and stores it under key (see TokenKey). A token the cluster rejects
+// is not stored and leaves any previous token in place; if the cluster cannot be reached the token
+// is stored unchecked.
+func StoreToken(ctx context.Context, c discovery.Cluster, key, input string) (string, error) {
+	token := sanitizeToken(input)
+	if token == "" {
+		return "", fmt.Errorf("no valid token detected")
 	}
+	client, err := TargetClient(c, token)
+	if err != nil {
+		return "", err
+	}
+	id, idErr := client.Identity(ctx)
+	if kubeapi.IsUnauthorized(idErr) {
+		return "", fmt.Errorf("token rejected by cluster %s", c.Name)
+	}
+	if err := keystore.SetTargetToken(key, token); err != nil {
+		return "", err
+	}
+	if idErr == nil {
+		info, _, _ := keystore.GetTargetTokenInfo(key)
+		_, _ = recordIdentity(key, info, id)
+	}
+	return token, nil
+}
 
-	return args, cleanup, nil
+// HasKubeconfig reports whether cluster clusterName is accessed through a kubeconfig
+// (MOC_TARGET_KUBECONFIG or ~/.config/multi-oc/kubeconfigs/<hub-id>/<cluster>.kubeconfig) instead of a token.
+func HasKubeconfig(clusterName string) bool {
+	return findKubeconfigForCluster(clusterName) != ""
 }
 
 // findKubeconfigForCluster returns a kubeconfig file to use for the given cluster
@@ -92,7 +156,7 @@ func findKubeconfigForCluster(clusterName string) string {
 			return env
 		}
 	}
-	// default location ~/.config/multi-oc/kubeconfigs/<cluster>.kubeconfig
+	// default location ~/.config/multi-oc/kubeconfigs/<hub-id>/<cluster>.kubeconfig
 	if def, err := keystore.KubeconfigPath(clusterName); err == nil {
 		if st, err := os.Stat(def); err == nil && !st.IsDir() {
 			return def
@@ -0,0 +1,105 @@
+package kubeexec
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"multi-oc/internal/keystore"
+)
+
+// Credential sources for target clusters (--auth, MOC_TARGET_AUTH).
+const (
+	// AuthUser logs in as the user: password, browser or pasted token (default).
+	AuthUser = "user"
+	// AuthMSA uses a token of an ACM ManagedServiceAccount, read from the hub.
+	AuthMSA = "msa"
+)
+
+// TokenKey returns the name the token of a cluster is stored under for the credential source
+// auth: the cluster name for the user's own token, keystore.MSAKey for AuthMSA.
+func TokenKey(clusterName, auth string) string {
+	if auth == AuthMSA {
+		return keystore.MSAKey(clusterName)
+	}
+	return clusterName
+}
+
+// Options choose how the target clusters of a run are reached. The direct flags set them; what
+// no flag sets comes from the environment (see OptionsFromEnv).
+type Options struct {
+	// Auth is the credential source for missing tokens, AuthUser or AuthMSA.
+	Auth string
+	// Username logs in with a password instead of the browser or a pasted token; with
+	// ReusePassword the password is asked for once per run.
+	Username      string
+	ReusePassword bool
+	// APIURLIndex always uses that API URL of clusters with several of them (from 0; -1 if not set).
+	APIURLIndex int
+	// APIURLPrefer tries the API URLs matching it first (nil if not set).
+	APIURLPrefer *regexp.Regexp
+}
+
+// OptionsFromEnv returns the options given through the environment:
+//
+//	MOC_TARGET_AUTH=msa             → Auth
+//	MOC_TARGET_USERNAME=alice       → Username
+//	MOC_TARGET_REUSE_PASSWORD=true  → ReusePassword
+//	MOC_API_URL_INDEX=1             → APIURLIndex
+//	MOC_API_URL_PREFER=regexp       → APIURLPrefer
+func OptionsFromEnv() (Options, error) {
+	o := Options{
+		Auth:          AuthUser,
+		Username:      strings.TrimSpace(os.Getenv("MOC_TARGET_USERNAME")),
+		ReusePassword: os.Getenv("MOC_TARGET_REUSE_PASSWORD") == "true",
+		APIURLIndex:   -1,
+	}
+	if v := os.Getenv("MOC_TARGET_AUTH"); strings.TrimSpace(v) != "" {
+		if err := o.SetAuth(v); err != nil {
+			return o, err
+		}
+	}
+	if v := os.Getenv("MOC_API_URL_INDEX"); strings.TrimSpace(v) != "" {
+		if err := o.SetAPIURLIndex(v); err != nil {
+			return o, err
+		}
+	}
+	if v := os.Getenv("MOC_API_URL_PREFER"); v != "" {
+		if err := o.SetAPIURLPrefer(v); err != nil {
+			return o, err
+		}
+	}
+	return o, nil
+}
+
+// SetAuth sets the credential source from a flag or variable value.
+func (o *Options) SetAuth(v string) error {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v != AuthUser && v != AuthMSA {
+		return fmt.Errorf("--auth expects %s or %s, got %q", AuthUser, AuthMSA, v)
+	}
+	o.Auth = v
+	return nil
+}
+
+// SetAPIURLIndex sets the API URL index from a flag or variable value.
+func (o *Options) SetAPIURLIndex(v string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return fmt.Errorf("--api-url-index expects a number from 0, got %q", v)
+	}
+	o.APIURLIndex = n
+	return nil
+}
+
+// SetAPIURLPrefer sets the preferred API URLs from a flag or variable value.
+func (o *Options) SetAPIURLPrefer(v string) error {
+	re, err := regexp.Compile(v)
+	if err != nil {
+		return fmt.Errorf("invalid --api-url-prefer expression: %w", err)
+	}
+	o.APIURLPrefer = re
+	return nil
+}
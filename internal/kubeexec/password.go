@@ -0,0 +1,59 @@
+package kubeexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/oauth"
+	"multi-oc/internal/prompt"
+)
+
+// reused holds the password entered for the first cluster of a run with Options.ReusePassword.
+// It is kept in memory only.
+var reused struct {
+	sync.Mutex
+	password string
+}
+
+// passwordLogin obtains a token for c from its OAuth server with username and a password (prompted
+// once per cluster, or once per run with reuse).
+func passwordLogin(ctx context.Context, c discovery.Cluster, username string, reuse bool) (string, error) {
+	reused.Lock()
+	defer reused.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		password := ""
+		if reuse {
+			password = reused.password
+		}
+		fromCache := password != ""
+		if !fromCache {
+			var err error
+			password, err = prompt.Password(fmt.Sprintf("Password for %s on %s: ", username, c.Name))
+			if err != nil {
+				return "", err
+			}
+			if password == "" {
+				return "", fmt.Errorf("no password entered")
+			}
+		}
+		tok, err := oauth.ChallengeToken(ctx, TargetConfig(c, ""), username, password)
+		if err == nil {
+			if reuse {
+				reused.password = password
+			}
+			return tok.AccessToken, nil
+		}
+		// A reused password may simply not be valid on this cluster: ask once for this one.
+		if errors.Is(err, oauth.ErrBadCredentials) && fromCache && attempt == 0 {
+			fmt.Fprintf(os.Stderr, "The password was rejected by %s.\n", c.Name)
+			reused.password = ""
+			continue
+		}
+		return "", err
+	}
+}
@@ -0,0 +1,112 @@
+package kubeexec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"multi-oc/internal/configstate"
+	"multi-oc/internal/discovery"
+	"multi-oc/internal/keystore"
+	"multi-oc/internal/kubeapi"
+)
+
+// validateInterval is how long a successful check of a cached token is trusted before the
+// cluster is asked again. Expiry is checked locally on every use.
+const validateInterval = 15 * time.Minute
+
+// TargetConfig describes how to reach cluster c with token: TLS and proxy settings come from
+// config.yaml, MOC_TARGET_CA_FILE and MOC_TARGET_INSECURE win over it.
+func TargetConfig(c discovery.Cluster, token string) kubeapi.Config {
+	s := targetSettings(c)
+	cfg := kubeapi.Config{
+		Server:  c.APIURL,
+		Token:   token,
+		CAData:  c.CAData,
+		CAFile:  s.CAFile,
+		Proxy:   s.Proxy,
+		Timeout: 10 * time.Second,
+	}
+	if s.Insecure != nil {
+		cfg.Insecure = *s.Insecure
+	}
+	if v := os.Getenv("MOC_TARGET_CA_FILE"); v != "" {
+		cfg.CAFile = v
+	}
+	if v := os.Getenv("MOC_TARGET_INSECURE"); v != "" {
+		cfg.Insecure = v == "true"
+	}
+	return cfg
+}
+
+// targetSettings returns the config.yaml settings of cluster c. The file has been validated at
+// startup, so errors only mean it changed since and are ignored here.
+func targetSettings(c discovery.Cluster) configstate.Settings {
+	s, _ := configstate.ClusterSettings(c.Name, c.Labels)
+	return s
+}
+
+// RequestTimeout returns the --request-timeout for oc calls on cluster c (requestTimeout in
+// config.yaml, default 30s).
+func RequestTimeout(c discovery.Cluster) string {
+	if s := targetSettings(c); s.RequestTimeout != "" {
+		return s.RequestTimeout
+	}
+	return "30s"
+}
+
+// TargetClient returns an API client for cluster c using token and the MOC_TARGET_* TLS settings.
+func TargetClient(c discovery.Cluster, token string) (*kubeapi.Client, error) {
+	return kubeapi.New(TargetConfig(c, token))
+}
+
+// CheckToken asks cluster c who token belongs to and when it expires, and records the answer in the
+// metadata of the token stored under key (see TokenKey). The stored metadata is returned unchanged
+// together with the error if the cluster could not be asked or rejected the token.
+func CheckToken(ctx context.Context, c discovery.Cluster, key, token string) (keystore.TokenInfo, error) {
+	info, _, _ := keystore.GetTargetTokenInfo(key)
+	client, err := TargetClient(c, token)
+	if err != nil {
+		return info, err
+	}
+	id, err := client.Identity(ctx)
+	if err != nil {
+		return info, err
+	}
+	return recordIdentity(key, info, id)
+}
+
+// recordIdentity stores id as the validated identity of the token stored under key.
+func recordIdentity(key string, info keystore.TokenInfo, id kubeapi.Identity) (keystore.TokenInfo, error) {
+	info.User = id.User
+	info.Groups = id.Groups
+	info.ExpiresAt = id.ExpiresAt
+	info.ValidatedAt = time.Now().UTC()
+	return info, keystore.SetTargetTokenInfo(key, info)
+}
+
+// cachedToken returns the token stored for c under key if it is still usable. Tokens past their recorded expiry
+// or rejected by the cluster (401) are removed; if the cluster cannot be reached the token is kept
+// and oc reports the problem. An error means the token store could not be read (e.g. not unlocked).
+func cachedToken(ctx context.Context, c discovery.Cluster, key string) (string, error) {
+	t, err := keystore.GetTargetToken(key)
+	if err != nil || t == "" {
+		return "", err
+	}
+	token := sanitizeToken(t)
+	info, ok, _ := keystore.GetTargetTokenInfo(key)
+	if ok && info.Expired(time.Now()) {
+		fmt.Fprintf(os.Stderr, "Token for cluster %s expired at %s.\n", c.Name, info.ExpiresAt.Local().Format(time.RFC3339))
+		_ = keystore.DeleteTargetToken(key)
+		return "", nil
+	}
+	if !ok || time.Since(info.ValidatedAt) > validateInterval {
+		if _, err := CheckToken(ctx, c, key, token); kubeapi.IsUnauthorized(err) {
+			fmt.Fprintf(os.Stderr, "Token for cluster %s was rejected by the cluster.\n", c.Name)
+			_ = keystore.DeleteTargetToken(key)
+			return "", nil
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,232 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operator is the comparison used by a Requirement.
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a single term of a label selector, e.g. "env=prod" or "region notin (eu,us)".
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector is a conjunction of requirements. An empty selector matches everything.
+type Selector []Requirement
+
+var (
+	setRe   = regexp.MustCompile(`^([^\s!=(),]+)\s+(in|notin)\s*\((.*)\)$`)
+	keyRe   = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]*/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	valueRe = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+)
+
+// Parse parses a selector using Kubernetes label-selector syntax:
+//
+//	key=value, key==value, key!=value   equality
+//	key in (a,b), key notin (a,b)       set-based
+//	key, !key                           existence
+//
+// Requirements are separated by commas and must all match.
+func Parse(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitTerms splits on commas that are not inside parentheses.
+func splitTerms(s string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if m := setRe.FindStringSubmatch(term); m != nil {
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return Requirement{}, fmt.Errorf("invalid selector %q: empty value set", term)
+		}
+		return newRequirement(m[1], Operator(m[2]), values, term)
+	}
+	if strings.HasPrefix(term, "!") {
+		return newRequirement(strings.TrimSpace(term[1:]), DoesNotExist, nil, term)
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(term, op); i >= 0 {
+			key := strings.TrimSpace(term[:i])
+			value := strings.TrimSpace(term[i+len(op):])
+			o := Equals
+			if op == "!=" {
+				o = NotEquals
+			}
+			return newRequirement(key, o, []string{value}, term)
+		}
+	}
+	return newRequirement(term, Exists, nil, term)
+}
+
+func newRequirement(key string, op Operator, values []string, term string) (Requirement, error) {
+	if !validKey(key) {
+		return Requirement{}, fmt.Errorf("invalid selector %q: bad label key %q", term, key)
+	}
+	for _, v := range values {
+		if len(v) > 63 || !valueRe.MatchString(v) {
+			return Requirement{}, fmt.Errorf("invalid selector %q: bad label value %q", term, v)
+		}
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+// validKey checks a label key as Kubernetes does: an optional DNS prefix of up to 253 characters
+// and "/", then a name of up to 63 characters.
+func validKey(key string) bool {
+	if !keyRe.MatchString(key) {
+		return false
+	}
+	prefix, name, ok := strings.Cut(key, "/")
+	if !ok {
+		return len(key) <= 63
+	}
+	return len(prefix) <= 253 && len(name) <= 63
+}
+
+// Matches reports whether the given labels satisfy all requirements.
+func (s Selector) Matches(lbls map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(lbls) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether the given labels satisfy the requirement.
+// As in Kubernetes, != and notin also match when the label is absent.
+func (r Requirement) Matches(lbls map[string]string) bool {
+	v, ok := lbls[r.Key]
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && contains(r.Values, v)
+	case NotEquals, NotIn:
+		return !ok || !contains(r.Values, v)
+	}
+	return false
+}
+
+// String renders the selector in the same syntax accepted by Parse.
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		switch r.Operator {
+		case Exists:
+			parts = append(parts, r.Key)
+		case DoesNotExist:
+			parts = append(parts, "!"+r.Key)
+		case Equals, NotEquals:
+			parts = append(parts, r.Key+string(r.Operator)+r.Values[0])
+		default:
+			vals := append([]string(nil), r.Values...)
+			sort.Strings(vals)
+			parts = append(parts, fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(vals, ",")))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelSelector mirrors metav1.LabelSelector as it appears in Kubernetes API objects.
+type LabelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels,omitempty"`
+	MatchExpressions []struct {
+		Key      string   `json:"key"`
+		Operator string   `json:"operator"`
+		Values   []string `json:"values,omitempty"`
+	} `json:"matchExpressions,omitempty"`
+}
+
+// Selector converts a LabelSelector into a Selector. An empty LabelSelector matches everything.
+func (ls LabelSelector) Selector() (Selector, error) {
+	var sel Selector
+	keys := make([]string, 0, len(ls.MatchLabels))
+	for k := range ls.MatchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sel = append(sel, Requirement{Key: k, Operator: Equals, Values: []string{ls.MatchLabels[k]}})
+	}
+	for _, e := range ls.MatchExpressions {
+		var op Operator
+		switch e.Operator {
+		case "In":
+			op = In
+		case "NotIn":
+			op = NotIn
+		case "Exists":
+			op = Exists
+		case "DoesNotExist":
+			op = DoesNotExist
+		default:
+			return nil, fmt.Errorf("unsupported label selector operator %q", e.Operator)
+		}
+		sel = append(sel, Requirement{Key: e.Key, Operator: op, Values: e.Values})
+	}
+	return sel, nil
+}
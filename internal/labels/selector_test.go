@@ -0,0 +1,123 @@
+package labels
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Selector
+	}{
+		{"", nil},
+		{"env=prod", Selector{{Key: "env", Operator: Equals, Values: []string{"prod"}}}},
+		{"env==prod", Selector{{Key: "env", Operator: Equals, Values: []string{"prod"}}}},
+		{"env != prod", Selector{{Key: "env", Operator: NotEquals, Values: []string{"prod"}}}},
+		{"env=", Selector{{Key: "env", Operator: Equals, Values: []string{""}}}},
+		{"region in (eu, us),tier", Selector{
+			{Key: "region", Operator: In, Values: []string{"eu", "us"}},
+			{Key: "tier", Operator: Exists},
+		}},
+		{"region notin (eu),!legacy", Selector{
+			{Key: "region", Operator: NotIn, Values: []string{"eu"}},
+			{Key: "legacy", Operator: DoesNotExist},
+		}},
+		{"cluster.open-cluster-management.io/clusterset=prod", Selector{
+			{Key: "cluster.open-cluster-management.io/clusterset", Operator: Equals, Values: []string{"prod"}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"=prod",
+		"env=prod=eu",
+		"env=pr od",
+		"env=-prod",
+		"env in ()",
+		"env in (a b)",
+		"bad key=x",
+		"env=" + strings.Repeat("a", 64),
+		strings.Repeat("k", 64) + "=x",
+		"a/b/c=x",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q): expected an error", in)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	lbls := map[string]string{"env": "prod", "region": "eu"}
+	tests := []struct {
+		sel  string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"missing!=x", true},
+		{"region in (eu,us)", true},
+		{"region notin (eu)", false},
+		{"missing notin (eu)", true},
+		{"env", true},
+		{"!env", false},
+		{"env=prod,region=us", false},
+	}
+	for _, tt := range tests {
+		sel, err := Parse(tt.sel)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.sel, err)
+		}
+		if got := sel.Matches(lbls); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.sel, lbls, got, tt.want)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, in := range []string{"env=prod", "env!=prod", "tier", "!legacy", "region in (eu,us)", "a=b,c notin (x)"} {
+		sel, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := Parse(sel.String())
+		if err != nil || !reflect.DeepEqual(again, sel) {
+			t.Errorf("%q → %q → %#v (%v)", in, sel.String(), again, err)
+		}
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	var ls LabelSelector
+	ls.MatchLabels = map[string]string{"env": "prod"}
+	ls.MatchExpressions = append(ls.MatchExpressions, struct {
+		Key      string   `json:"key"`
+		Operator string   `json:"operator"`
+		Values   []string `json:"values,omitempty"`
+	}{Key: "region", Operator: "NotIn", Values: []string{"us"}})
+	sel, err := ls.Selector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sel.Matches(map[string]string{"env": "prod", "region": "eu"}) || sel.Matches(map[string]string{"env": "prod", "region": "us"}) {
+		t.Errorf("unexpected matches for %s", sel)
+	}
+	ls.MatchExpressions[0].Operator = "Gt"
+	if _, err := ls.Selector(); err == nil {
+		t.Error("unsupported operator must be an error")
+	}
+}
@@ -0,0 +1,160 @@
+package msa
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"multi-oc/internal/identity"
+	"multi-oc/internal/kubeapi"
+)
+
+const (
+	apiVersion = "authentication.open-cluster-management.io/v1beta1"
+	// defaultName is the ManagedServiceAccount moc creates in every cluster namespace.
+	defaultName = "multi-oc"
+	// defaultValidity is the token lifetime requested for new ManagedServiceAccounts.
+	defaultValidity = "24h"
+	// readyTimeout bounds how long Token waits for the addon to report a token.
+	readyTimeout = 60 * time.Second
+)
+
+type managedServiceAccount struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Rotation struct {
+			Enabled  bool   `json:"enabled"`
+			Validity string `json:"validity,omitempty"`
+		} `json:"rotation"`
+	} `json:"spec"`
+	Status struct {
+		TokenSecretRef *struct {
+			Name string `json:"name"`
+		} `json:"tokenSecretRef,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+type secret struct {
+	Data map[string]string `json:"data"`
+}
+
+// Name returns the name of the ManagedServiceAccount used by moc (MOC_MSA_NAME, default "multi-oc").
+func Name() string {
+	if v := strings.TrimSpace(os.Getenv("MOC_MSA_NAME")); v != "" {
+		return v
+	}
+	return defaultName
+}
+
+// validity returns the token lifetime for new ManagedServiceAccounts (MOC_MSA_VALIDITY, default 24h).
+func validity() string {
+	if v := strings.TrimSpace(os.Getenv("MOC_MSA_VALIDITY")); v != "" {
+		return v
+	}
+	return defaultValidity
+}
+
+// Token returns a service account token for a managed cluster from its ManagedServiceAccount on the
+// hub. If the ManagedServiceAccount does not exist in the cluster namespace yet, it is created and
+// Token waits until the managed-serviceaccount addon has projected the token secret to the hub.
+// Only the hub session is needed. Token creates no RBAC: the service account starts without any
+// permissions on the managed cluster, and whatever it may do there has to be granted separately.
+func Token(ctx context.Context, cluster string) (string, error) {
+	client, err := hubClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	name := Name()
+	base := "/apis/" + apiVersion + "/namespaces/" + url.PathEscape(cluster) + "/managedserviceaccounts"
+
+	var m managedServiceAccount
+	err = client.Get(ctx, base+"/"+url.PathEscape(name), nil, &m)
+	if kubeapi.IsUnauthorized(err) {
+		// expired hub session: log in again and retry once
+		if err := identity.EnsureHubLogin(ctx); err != nil {
+			return "", err
+		}
+		if client, err = identity.HubClient(); err != nil {
+			return "", err
+		}
+		err = client.Get(ctx, base+"/"+url.PathEscape(name), nil, &m)
+	}
+	if kubeapi.IsNotFound(err) {
+		err = create(ctx, client, base, cluster, name)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Created ManagedServiceAccount %s/%s on the hub; waiting for its token...\n", cluster, name)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(readyTimeout)
+	for m.Status.TokenSecretRef == nil || m.Status.TokenSecretRef.Name == "" {
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("ManagedServiceAccount %s/%s has no token yet (is the managed-serviceaccount addon running on %s?)", cluster, name, cluster)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+		if err := client.Get(ctx, base+"/"+url.PathEscape(name), nil, &m); err != nil && !kubeapi.IsNotFound(err) {
+			return "", err
+		}
+	}
+
+	var s secret
+	path := "/api/v1/namespaces/" + url.PathEscape(cluster) + "/secrets/" + url.PathEscape(m.Status.TokenSecretRef.Name)
+	if err := client.Get(ctx, path, nil, &s); err != nil {
+		return "", fmt.Errorf("reading token secret of ManagedServiceAccount %s/%s: %w", cluster, name, err)
+	}
+	tok, err := base64.StdEncoding.DecodeString(s.Data["token"])
+	if err != nil || len(tok) == 0 {
+		return "", fmt.Errorf("token secret of ManagedServiceAccount %s/%s has no token", cluster, name)
+	}
+	return string(tok), nil
+}
+
+func create(ctx context.Context, client *kubeapi.Client, base, cluster, name string) error {
+	var m managedServiceAccount
+	m.APIVersion = apiVersion
+	m.Kind = "ManagedServiceAccount"
+	m.Metadata.Name = name
+	m.Metadata.Namespace = cluster
+	m.Spec.Rotation.Enabled = true
+	m.Spec.Rotation.Validity = validity()
+	err := client.Do(ctx, http.MethodPost, base, nil, m, nil)
+	var apiErr *kubeapi.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// created concurrently by another moc run
+		return nil
+	}
+	if kubeapi.IsNotFound(err) {
+		return fmt.Errorf("ManagedServiceAccount API not available on the hub (enable the managed-serviceaccount addon): %w", err)
+	}
+	return err
+}
+
+// hubClient returns the hub API client, logging in first if there is no hub session yet.
+func hubClient(ctx context.Context) (*kubeapi.Client, error) {
+	client, err := identity.HubClient()
+	if errors.Is(err, identity.ErrNoHubSession) {
+		if err := identity.EnsureHubLogin(ctx); err != nil {
+			return nil, err
+		}
+		return identity.HubClient()
+	}
+	return client, err
+}
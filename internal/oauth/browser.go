@@ -0,0 +1,209 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"multi-oc/internal/kubeapi"
+)
+
+// CLIClient is the public OAuth client OpenShift provides for browser logins of CLIs
+// ("oc login --web"); it accepts loopback redirect URIs on any port.
+const CLIClient = "openshift-cli-client"
+
+// browserTimeout bounds how long BrowserToken waits for the browser to come back.
+const browserTimeout = 3 * time.Minute
+
+// ErrBrowserTimeout is returned if the login in the browser was not completed in time.
+var ErrBrowserTimeout = errors.New("browser login not completed in time")
+
+type headlessKey struct{}
+
+// WithHeadless returns a context in which no browser is opened for logins (--headless), including
+// hub logins that become necessary in the middle of a run.
+func WithHeadless(ctx context.Context) context.Context {
+	return context.WithValue(ctx, headlessKey{}, true)
+}
+
+// BrowserAvailable reports whether a browser can be opened for logins: not disabled with
+// WithHeadless or MOC_HEADLESS=true, a graphical session (DISPLAY/WAYLAND_DISPLAY on Linux) and an
+// opener command.
+func BrowserAvailable(ctx context.Context) bool {
+	if headless, _ := ctx.Value(headlessKey{}).(bool); headless || os.Getenv("MOC_HEADLESS") == "true" {
+		return false
+	}
+	if runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return false
+	}
+	_, err := exec.LookPath(opener())
+	return err == nil
+}
+
+// BrowserToken obtains an access token with the authorization-code flow and PKCE: it opens the
+// OAuth server's login page in the browser and receives the code on a loopback listener.
+// cfg describes the API server; the OAuth server is found via Discover.
+func BrowserToken(ctx context.Context, cfg kubeapi.Config) (Token, error) {
+	md, err := Discover(ctx, cfg)
+	if err != nil {
+		return Token{}, err
+	}
+	if md.TokenEndpoint == "" {
+		return Token{}, fmt.Errorf("OAuth server discovery failed: no token endpoint published by %s", cfg.Server)
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return Token{}, err
+	}
+	state, err := randomString()
+	if err != nil {
+		return Token{}, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return Token{}, err
+	}
+	defer ln.Close()
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"client_id":             {CLIClient},
+		"response_type":         {"code"},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+	}
+	authURL := md.AuthorizationEndpoint + "?" + q.Encode()
+
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		p := r.URL.Query()
+		var res result
+		switch {
+		case p.Get("state") != state:
+			res.err = fmt.Errorf("OAuth callback with unexpected state")
+		case p.Get("error") != "":
+			res.err = fmt.Errorf("OAuth error %s: %s", p.Get("error"), p.Get("error_description"))
+		case p.Get("code") == "":
+			res.err = fmt.Errorf("OAuth callback without code")
+		default:
+			res.code = p.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, "Login failed: "+res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login successful. You can close this window and return to the terminal.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	}), ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	fmt.Fprintf(os.Stderr, "Opening the browser to log in to %s. If it does not open, visit:\n  %s\n", hostOf(cfg.Server), authURL)
+	if cmd := exec.Command(opener(), authURL); cmd.Start() == nil {
+		go func() { _ = cmd.Wait() }()
+	} else {
+		fmt.Fprintln(os.Stderr, "Could not open the browser.")
+	}
+
+	timer := time.NewTimer(browserTimeout)
+	defer timer.Stop()
+	var res result
+	select {
+	case res = <-done:
+	case <-timer.C:
+		return Token{}, ErrBrowserTimeout
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	}
+	if res.err != nil {
+		return Token{}, res.err
+	}
+	return exchangeCode(ctx, cfg, md.TokenEndpoint, res.code, redirectURI, verifier)
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func exchangeCode(ctx context.Context, cfg kubeapi.Config, tokenEndpoint, code, redirectURI, verifier string) (Token, error) {
+	client, err := oauthHTTPClient(cfg)
+	if err != nil {
+		return Token{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {CLIClient},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Token{}, err
+	}
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		if tr.Error != "" {
+			return Token{}, fmt.Errorf("token exchange failed: %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		return Token{}, fmt.Errorf("token exchange failed: %s", resp.Status)
+	}
+	return Token{AccessToken: tr.AccessToken, ExpiresIn: tr.ExpiresIn}, nil
+}
+
+// randomString returns 32 random bytes, base64url-encoded (valid as PKCE verifier and state).
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func opener() string {
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+	return "xdg-open"
+}
@@ -0,0 +1,35 @@
+package output
+
+import (
+	"fmt"
+	"time"
+)
+
+// HumanDuration formats a duration like kubectl's AGE column (e.g. 45s, 5m3s, 17h, 3d4h, 120d).
+func HumanDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	s := int(d.Seconds())
+	switch {
+	case s < 120:
+		return fmt.Sprintf("%ds", s)
+	case d < 10*time.Minute:
+		return fmt.Sprintf("%dm%ds", s/60, s%60)
+	case d < 3*time.Hour:
+		return fmt.Sprintf("%dm", s/60)
+	case d < 8*time.Hour:
+		return fmt.Sprintf("%dh%dm", s/3600, (s%3600)/60)
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", s/3600)
+	case d < 8*24*time.Hour:
+		if h := (s % 86400) / 3600; h > 0 {
+			return fmt.Sprintf("%dd%dh", s/86400, h)
+		}
+		return fmt.Sprintf("%dd", s/86400)
+	case d < 2*365*24*time.Hour:
+		return fmt.Sprintf("%dd", s/86400)
+	default:
+		return fmt.Sprintf("%dy", s/(365*86400))
+	}
+}
@@ -0,0 +1,207 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"multi-oc/internal/fanout"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a merged output format for multi-cluster runs.
+type Format string
+
+const (
+	JSON   Format = "json"
+	YAML   Format = "yaml"
+	NDJSON Format = "ndjson"
+)
+
+// ClusterAnnotation is set on every merged item to record the cluster it came from.
+const ClusterAnnotation = "multi-oc/cluster"
+
+// StructuredFormat looks for -o/--output json|yaml|ndjson in the oc arguments.
+// If found, it returns the format and a copy of the arguments that asks oc for JSON instead,
+// so that the per-cluster documents can be merged.
+func StructuredFormat(ocArgs []string) (Format, []string, bool) {
+	idx, value := outputFlag(ocArgs)
+	if idx < 0 {
+		return "", ocArgs, false
+	}
+	f := Format(value)
+	switch f {
+	case JSON, YAML, NDJSON:
+	default:
+		return "", ocArgs, false
+	}
+	return f, withJSONOutput(ocArgs, idx), true
+}
+
+// withJSONOutput returns a copy of args in which the output flag at idx (or, if idx < 0,
+// an appended one) requests JSON.
+func withJSONOutput(ocArgs []string, idx int) []string {
+	args := append([]string(nil), ocArgs...)
+	if idx < 0 {
+		return append(args, "-o", "json")
+	}
+	switch a := args[idx]; {
+	case a == "-o" || a == "--output":
+		args[idx+1] = "json"
+	case strings.HasPrefix(a, "--output="):
+		args[idx] = "--output=json"
+	case strings.HasPrefix(a, "-o="):
+		args[idx] = "-o=json"
+	default:
+		args[idx] = "-ojson"
+	}
+	return args
+}
+
+// outputFlag returns the index and value of the last -o/--output flag before "--", or -1.
+func outputFlag(args []string) (int, string) {
+	idx, value := -1, ""
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return idx, value
+		case a == "-o" || a == "--output":
+			if i+1 < len(args) {
+				idx, value = i, args[i+1]
+				i++
+			}
+		case strings.HasPrefix(a, "--output="):
+			idx, value = i, strings.TrimPrefix(a, "--output=")
+		case strings.HasPrefix(a, "-o="):
+			idx, value = i, strings.TrimPrefix(a, "-o=")
+		case strings.HasPrefix(a, "-o") && len(a) > 2:
+			idx, value = i, a[2:]
+		}
+	}
+	return idx, value
+}
+
+// Items decodes the JSON output of one cluster and returns its objects, each annotated
+// with the cluster name. List documents are flattened into their items.
+func Items(r fanout.Result) ([]map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(r.Stdout))
+	dec.UseNumber()
+	var items []map[string]any
+	for {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: cannot parse oc output as JSON: %w", r.Cluster, err)
+		}
+		if list, ok := obj["items"].([]any); ok {
+			for _, it := range list {
+				if m, ok := it.(map[string]any); ok {
+					items = append(items, annotate(m, r.Cluster))
+				}
+			}
+			continue
+		}
+		items = append(items, annotate(obj, r.Cluster))
+	}
+	return items, nil
+}
+
+func annotate(obj map[string]any, cluster string) map[string]any {
+	meta, _ := obj["metadata"].(map[string]any)
+	if meta == nil {
+		meta = make(map[string]any)
+		obj["metadata"] = meta
+	}
+	ann, _ := meta["annotations"].(map[string]any)
+	if ann == nil {
+		ann = make(map[string]any)
+		meta["annotations"] = ann
+	}
+	ann[ClusterAnnotation] = cluster
+	return obj
+}
+
+// WriteNDJSON writes the items of one cluster as one JSON object per line.
+func WriteNDJSON(w io.Writer, r fanout.Result) error {
+	items, err := Items(r)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, it := range items {
+		if err := enc.Encode(it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMerged writes all successful results as a single v1 List in the given format.
+// Results that are not valid JSON are reported on errw and skipped.
+func WriteMerged(w, errw io.Writer, f Format, results []fanout.Result) error {
+	all := make([]any, 0)
+	for _, r := range results {
+		if !r.OK() {
+			continue
+		}
+		items, err := Items(r)
+		if err != nil {
+			fmt.Fprintln(errw, err)
+			continue
+		}
+		for _, it := range items {
+			all = append(all, it)
+		}
+	}
+	list := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]any{"resourceVersion": ""},
+		"items":      all,
+	}
+	switch f {
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(yamlNumbers(list)); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		b, err := json.MarshalIndent(list, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+}
+
+// yamlNumbers replaces json.Number values, which the YAML encoder would quote, with ints or floats.
+func yamlNumbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, x := range t {
+			t[k] = yamlNumbers(x)
+		}
+	case []any:
+		for i, x := range t {
+			t[i] = yamlNumbers(x)
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return n
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return string(t)
+	}
+	return v
+}
@@ -0,0 +1,193 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"multi-oc/internal/fanout"
+)
+
+// Table describes how a fleet-wide "get" is rendered as one combined table.
+type Table struct {
+	NoHeaders bool
+}
+
+// TableFormat reports whether the oc arguments describe a "get" whose tables can be combined:
+// oc's own output (default, -o wide, -o custom-columns=...), so that every kind keeps the columns
+// the API server prints for it, as do -L, --show-labels and --sort-by. If so, it returns the table
+// options and the arguments for oc, without --no-headers since the headers locate the columns.
+func TableFormat(ocArgs []string) (Table, []string, bool) {
+	if len(ocArgs) == 0 || ocArgs[0] != "get" {
+		return Table{}, ocArgs, false
+	}
+	var t Table
+	args := make([]string, 0, len(ocArgs))
+	for i, a := range ocArgs {
+		switch {
+		case a == "--":
+			return Table{}, ocArgs, false
+		case a == "-w" || a == "--watch" || a == "--watch-only" || strings.HasPrefix(a, "--watch="):
+			return Table{}, ocArgs, false
+		case a == "--no-headers" || a == "--no-headers=true":
+			t.NoHeaders = true
+			continue
+		case a == "--no-headers=false":
+			continue
+		}
+		args = append(args, ocArgs[i])
+	}
+	switch _, value := outputFlag(args); {
+	case value == "", value == "wide":
+	case strings.HasPrefix(value, "custom-columns=") || strings.HasPrefix(value, "custom-columns-file="):
+	default:
+		return Table{}, ocArgs, false
+	}
+	return t, args, true
+}
+
+// block is one table printed by oc: the column headers and the cells of each row.
+type block struct {
+	headers []string
+	rows    [][]string
+}
+
+type clusterRow struct {
+	cluster string
+	cells   []string
+}
+
+// WriteTable combines the tables printed by oc on each cluster into tables with a leading CLUSTER
+// column and a single header. Tables of different kinds ("oc get pods,svc") stay separate. Rows keep
+// the order of the clusters and, within a cluster, the order oc printed them in (so --sort-by sorts
+// per cluster). If the output of a cluster is not a table oc would print, every cluster's output is
+// written as it is, prefixed with the cluster name.
+func WriteTable(w, errw io.Writer, t Table, results []fanout.Result) error {
+	var keys []string
+	rows := make(map[string][]clusterRow)
+	for _, r := range results {
+		if !r.OK() {
+			continue
+		}
+		blocks, err := parseTables(r.Stdout)
+		if err != nil {
+			fmt.Fprintf(errw, "%s: %v; printing the output of each cluster as is\n", r.Cluster, err)
+			for _, r := range results {
+				fanout.WritePrefixed(w, io.Discard, r)
+			}
+			return nil
+		}
+		for _, b := range blocks {
+			key := strings.Join(b.headers, "\t")
+			if _, ok := rows[key]; !ok {
+				keys = append(keys, key)
+				rows[key] = nil
+			}
+			for _, cells := range b.rows {
+				rows[key] = append(rows[key], clusterRow{cluster: r.Cluster, cells: cells})
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+		if !t.NoHeaders {
+			fmt.Fprintln(tw, "CLUSTER\t"+key)
+		}
+		for _, r := range rows[key] {
+			fmt.Fprintln(tw, r.cluster+"\t"+strings.Join(r.cells, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTables splits the output of "oc get" into its tables. Tables are separated by empty lines;
+// their first line holds the headers, separated by at least two spaces (a header such as
+// "NOMINATED NODE" contains single ones). Each row is cut at the columns where the headers start,
+// so cells may contain spaces as well.
+//
+// oc's table text is parsed, rather than its JSON rendered, because only oc knows every kind's
+// columns: the server-side Table columns, and -o wide, custom-columns, -L and --sort-by on top of
+// them. oc has no machine-readable form of that table, and "-o json" carries none of its columns.
+// Parsing it is sound because oc aligns tables with text/tabwriter: each column is padded to its
+// widest cell plus at least two spaces, counting runes, so every cell of a column starts where its
+// header does, whatever spaces or non-ASCII characters the cells contain. The headers come from
+// the API server and the custom-columns spec and are not translated by oc. Only a value containing
+// a tab or newline, which oc prints unescaped, shifts its row; that garbles oc's own table as well.
+// A row that does not line up with the headers is reported, and WriteTable then prints each
+// cluster's output as it is rather than guess.
+func parseTables(out []byte) ([]block, error) {
+	var blocks []block
+	for _, chunk := range bytes.Split(bytes.TrimRight(out, "\n"), []byte("\n\n")) {
+		lines := strings.Split(strings.TrimRight(string(chunk), "\n"), "\n")
+		if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+			continue
+		}
+		headers, starts := splitHeader(lines[0])
+		if len(headers) == 0 {
+			return nil, fmt.Errorf("no table header in the output")
+		}
+		b := block{headers: headers}
+		for _, line := range lines[1:] {
+			cells, err := cutRow(line, starts)
+			if err != nil {
+				return nil, err
+			}
+			b.rows = append(b.rows, cells)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// splitHeader returns the headers of a table and the column (in runes) at which each one starts.
+func splitHeader(line string) ([]string, []int) {
+	var headers []string
+	var starts []int
+	runes := []rune(strings.TrimRight(line, " "))
+	for i := 0; i < len(runes); {
+		if runes[i] == ' ' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && !(runes[i] == ' ' && (i+1 >= len(runes) || runes[i+1] == ' ')) {
+			i++
+		}
+		headers = append(headers, string(runes[start:i]))
+		starts = append(starts, start)
+	}
+	return headers, starts
+}
+
+// cutRow cuts a table row at the given columns. Every column but the first must be preceded by a
+// space, otherwise the row does not belong to the table.
+func cutRow(line string, starts []int) ([]string, error) {
+	runes := []rune(line)
+	cells := make([]string, len(starts))
+	for i, start := range starts {
+		if start >= len(runes) {
+			cells[i] = ""
+			continue
+		}
+		if i > 0 && runes[start-1] != ' ' {
+			return nil, fmt.Errorf("row %q does not line up with the table header", line)
+		}
+		end := len(runes)
+		if i+1 < len(starts) && starts[i+1] < end {
+			end = starts[i+1]
+		}
+		cells[i] = strings.TrimSpace(string(runes[start:end]))
+	}
+	return cells, nil
+}
@@ -0,0 +1,168 @@
+package output
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"multi-oc/internal/fanout"
+)
+
+func TestTableFormat(t *testing.T) {
+	tests := []struct {
+		args      []string
+		ok        bool
+		noHeaders bool
+		want      []string
+	}{
+		{args: []string{"get", "pods"}, ok: true, want: []string{"get", "pods"}},
+		{args: []string{"get", "routes", "-o", "wide", "-L", "app"}, ok: true, want: []string{"get", "routes", "-o", "wide", "-L", "app"}},
+		{args: []string{"get", "pods", "--no-headers", "--sort-by=.metadata.name"}, ok: true, noHeaders: true,
+			want: []string{"get", "pods", "--sort-by=.metadata.name"}},
+		{args: []string{"get", "cm", "-ocustom-columns=NAME:.metadata.name"}, ok: true, want: []string{"get", "cm", "-ocustom-columns=NAME:.metadata.name"}},
+		{args: []string{"get", "pods", "-o", "name"}},
+		{args: []string{"get", "pods", "-o", "jsonpath={.items}"}},
+		{args: []string{"get", "pods", "-w"}},
+		{args: []string{"describe", "pods"}},
+	}
+	for _, tt := range tests {
+		tbl, args, ok := TableFormat(tt.args)
+		if ok != tt.ok {
+			t.Errorf("TableFormat(%q) ok = %v", tt.args, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if tbl.NoHeaders != tt.noHeaders || !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("TableFormat(%q) = %+v, %q", tt.args, tbl, args)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	c1 := "NAME                READY   STATUS    RESTARTS   AGE   NOMINATED NODE\n" +
+		"web-5d4f8c-abcde    1/1     Running   0          3d    <none>\n" +
+		"db-0                0/1     Pending   0          1m    <none>\n"
+	c2 := "NAME        READY   STATUS             RESTARTS      AGE   NOMINATED NODE\n" +
+		"web-1       0/1     CrashLoopBackOff   4 (1m ago)    2h    <none>\n"
+	results := []fanout.Result{
+		{Cluster: "prod-1", Stdout: []byte(c1)},
+		{Cluster: "prod-2", Stdout: []byte(c2)},
+		{Cluster: "prod-3", Stderr: []byte("error: unreachable\n"), ExitCode: 1},
+	}
+	var out, errw bytes.Buffer
+	if err := WriteTable(&out, &errw, Table{}, results); err != nil {
+		t.Fatal(err)
+	}
+	want := "CLUSTER   NAME               READY   STATUS             RESTARTS     AGE   NOMINATED NODE\n" +
+		"prod-1    web-5d4f8c-abcde   1/1     Running            0            3d    <none>\n" +
+		"prod-1    db-0               0/1     Pending            0            1m    <none>\n" +
+		"prod-2    web-1              0/1     CrashLoopBackOff   4 (1m ago)   2h    <none>\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	if errw.Len() != 0 {
+		t.Errorf("unexpected stderr %q", errw.String())
+	}
+}
+
+func TestWriteTableKinds(t *testing.T) {
+	out1 := "NAME          READY   STATUS    RESTARTS   AGE\npod/a         1/1     Running   0          1d\n\n" +
+		"NAME        TYPE        CLUSTER-IP   EXTERNAL-IP   PORT(S)   AGE\nservice/s   ClusterIP   10.0.0.1     <none>        80/TCP    1d\n"
+	out2 := "NAME          READY   STATUS    RESTARTS   AGE\npod/b         1/1     Running   0          2d\n"
+	results := []fanout.Result{{Cluster: "a", Stdout: []byte(out1)}, {Cluster: "b", Stdout: []byte(out2)}}
+	var out bytes.Buffer
+	if err := WriteTable(&out, &bytes.Buffer{}, Table{NoHeaders: true}, results); err != nil {
+		t.Fatal(err)
+	}
+	tables := strings.Split(out.String(), "\n\n")
+	if len(tables) != 2 {
+		t.Fatalf("expected two tables, got %q", out.String())
+	}
+	if !strings.Contains(tables[0], "a   pod/a") || !strings.Contains(tables[0], "b   pod/b") || strings.Contains(tables[0], "NAME") {
+		t.Errorf("unexpected pod table %q", tables[0])
+	}
+	if !strings.HasPrefix(tables[1], "a   service/s") {
+		t.Errorf("unexpected service table %q", tables[1])
+	}
+}
+
+func TestWriteTableFallback(t *testing.T) {
+	results := []fanout.Result{
+		{Cluster: "a", Stdout: []byte("NAME   AGE\nx      1d\n")},
+		{Cluster: "b", Stdout: []byte("NAME   AGE\nmisaligned-row 1d\n")},
+	}
+	var out, errw bytes.Buffer
+	if err := WriteTable(&out, &errw, Table{}, results); err != nil {
+		t.Fatal(err)
+	}
+	want := "a: NAME   AGE\na: x      1d\nb: NAME   AGE\nb: misaligned-row 1d\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if !strings.Contains(errw.String(), "does not line up") {
+		t.Errorf("expected a note on stderr, got %q", errw.String())
+	}
+}
+
+func TestParseTablesEmptyCells(t *testing.T) {
+	blocks, err := parseTables([]byte("NAME   HOST/PORT          PATH   SERVICES\nr1     r1.apps.example           svc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []block{{headers: []string{"NAME", "HOST/PORT", "PATH", "SERVICES"}, rows: [][]string{{"r1", "r1.apps.example", "", "svc"}}}}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("got %#v", blocks)
+	}
+}
+
+func TestParseTablesSpacesInValues(t *testing.T) {
+	// oc get events: the MESSAGE column is free text with single and double spaces
+	events := "LAST SEEN   TYPE      REASON    OBJECT      MESSAGE\n" +
+		"2m          Warning   BackOff   pod/web-1   Back-off restarting failed container  web in pod web-1\n" +
+		"10s         Normal    Pulled    pod/db-0    Container image \"postgres:16\" already present\n"
+	// custom columns with spaces in headers and values, and runes beyond ASCII
+	custom := "NAME     OWNER TEAM        DESCRIPTION\n" +
+		"größe    Platform Ops      Größe der Ablage  (Cache)\n" +
+		"cm-2     <none>            reserved for later use\n"
+	tests := []struct {
+		in   string
+		want block
+	}{
+		{events, block{headers: []string{"LAST SEEN", "TYPE", "REASON", "OBJECT", "MESSAGE"}, rows: [][]string{
+			{"2m", "Warning", "BackOff", "pod/web-1", "Back-off restarting failed container  web in pod web-1"},
+			{"10s", "Normal", "Pulled", "pod/db-0", `Container image "postgres:16" already present`},
+		}}},
+		{custom, block{headers: []string{"NAME", "OWNER TEAM", "DESCRIPTION"}, rows: [][]string{
+			{"größe", "Platform Ops", "Größe der Ablage  (Cache)"},
+			{"cm-2", "<none>", "reserved for later use"},
+		}}},
+	}
+	for _, tt := range tests {
+		blocks, err := parseTables([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%v\n%s", err, tt.in)
+			continue
+		}
+		if len(blocks) != 1 || !reflect.DeepEqual(blocks[0], tt.want) {
+			t.Errorf("got %#v\nwant %#v", blocks, tt.want)
+		}
+	}
+
+	// the combined table keeps the values intact and realigns them
+	results := []fanout.Result{{Cluster: "c1", Stdout: []byte(custom)}, {Cluster: "cluster-2", Stdout: []byte(
+		"NAME   OWNER TEAM   DESCRIPTION\nx      App Dev      one  two\n")}}
+	var out bytes.Buffer
+	if err := WriteTable(&out, &bytes.Buffer{}, Table{}, results); err != nil {
+		t.Fatal(err)
+	}
+	want := "CLUSTER     NAME    OWNER TEAM     DESCRIPTION\n" +
+		"c1          größe   Platform Ops   Größe der Ablage  (Cache)\n" +
+		"c1          cm-2    <none>         reserved for later use\n" +
+		"cluster-2   x       App Dev        one  two\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
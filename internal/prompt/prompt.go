@@ -0,0 +1,36 @@
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdin is shared by all prompts so that input piped for several prompts is not lost in the
+// buffer of an earlier reader.
+var stdin = bufio.NewReader(os.Stdin)
+
+// Line prints msg to stderr and reads one line from stdin (without the trailing newline).
+func Line(msg string) string {
+	fmt.Fprint(os.Stderr, msg)
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// Password prints msg to stderr and reads a line without echoing it if stdin is a terminal.
+func Password(msg string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return Line(msg), nil
+	}
+	fmt.Fprint(os.Stderr, msg)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}